@@ -0,0 +1,84 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// disconnected is sent through the message channel when a tracker has no
+// connections left, so it's handled after everything the tracker sent.
+type disconnected struct {
+	mqtt.Identifier
+}
+
+// online marks a tracker available and (re)starts its inactivity timer.
+func (b *bridge) online(msg mqtt.Identifier, data topicData) {
+	deviceID := msg.Device()
+
+	b.mu.Lock()
+	if t := b.timers[deviceID]; t != nil {
+		t.Stop()
+		delete(b.timers, deviceID)
+	}
+
+	if timeout := b.cfg.Meta[deviceID].AvailabilityTimeout; timeout > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(timeout, func() {
+			b.mu.Lock()
+			current := b.timers[deviceID] == t
+			if current {
+				delete(b.timers, deviceID)
+			}
+			b.mu.Unlock()
+
+			if current {
+				log.Info().Str("device", msg.MQTTID()).Dur("timeout", timeout).Msg("Device went quiet, marking offline.")
+				b.setAvailability(deviceID, data, "offline")
+			}
+		})
+
+		b.timers[deviceID] = t
+	}
+	b.mu.Unlock()
+
+	b.setAvailability(deviceID, data, "online")
+}
+
+// offline marks a tracker unavailable, last is the last packet it sent.
+func (b *bridge) offline(last mqtt.Identifier) {
+	deviceID := last.Device()
+
+	b.mu.Lock()
+	if t := b.timers[deviceID]; t != nil {
+		t.Stop()
+		delete(b.timers, deviceID)
+	}
+
+	// Rejected trackers were never online.
+	_, seen := b.availability[deviceID]
+	b.mu.Unlock()
+
+	if seen {
+		b.setAvailability(deviceID, deviceData(last, b.cfg.Meta[deviceID].Name), "offline")
+	}
+}
+
+// setAvailability publishes a tracker's availability if it has changed.
+func (b *bridge) setAvailability(deviceID string, data topicData, state string) {
+	m := message{
+		topic:   b.topics.render(kindDevice, data),
+		payload: []byte(state),
+	}
+
+	b.mu.Lock()
+	changed := string(b.availability[deviceID].payload) != state
+	b.availability[deviceID] = m
+	b.mu.Unlock()
+
+	if changed {
+		b.publish(m)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt"
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/health"
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/freman/gps2mqtt/position"
+	"github.com/freman/gps2mqtt/publisher"
+	"github.com/freman/gps2mqtt/voice"
+)
+
+// message is something published to MQTT that may need publishing again
+// after a reconnect.
+type message struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// maxWork is how much work the MQTT callbacks can queue for the bridge.
+const maxWork = 64
+
+// bridge turns packets from the trackers into MQTT messages, remembering
+// enough to announce everything again when the broker or Home Assistant
+// has forgotten about it.
+type bridge struct {
+	cfg       *gps2mqtt.Config
+	topics    *topics
+	client    client
+	publisher *publisher.Publisher
+
+	mu         sync.Mutex
+	identities map[string]topicData
+	commands   map[string]string
+	devices    map[string]homeassistant.Device
+	discovery  map[string][]message
+	attributes map[string]message
+	positions  map[string]*position.Position
+
+	availability map[string]message
+	timers       map[string]*time.Timer
+	alarms       map[string]map[event.Alarm]bool
+
+	// health is the last report of each measurement by topic, measurements
+	// what each tracker has reported.
+	health       map[string]message
+	measurements map[string]map[health.Measurement]bool
+
+	// work is done for the MQTT callbacks, which mustn't block.
+	work chan func()
+}
+
+func newBridge(cfg *gps2mqtt.Config) (*bridge, error) {
+	switch cfg.MQTT.Payload {
+	case payloadPacket, payloadEnvelope:
+	default:
+		return nil, fmt.Errorf("unknown payload layout %q", cfg.MQTT.Payload)
+	}
+
+	t, err := newTopics(cfg.MQTT)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bridge{
+		cfg:        cfg,
+		topics:     t,
+		identities: make(map[string]topicData),
+		commands:   make(map[string]string),
+		devices:    make(map[string]homeassistant.Device),
+		discovery:  make(map[string][]message),
+		attributes: make(map[string]message),
+		positions:  make(map[string]*position.Position),
+
+		availability: make(map[string]message),
+		timers:       make(map[string]*time.Timer),
+		alarms:       make(map[string]map[event.Alarm]bool),
+
+		health:       make(map[string]message),
+		measurements: make(map[string]map[health.Measurement]bool),
+
+		work: make(chan func(), maxWork),
+	}
+
+	go func() {
+		for fn := range b.work {
+			fn()
+		}
+	}()
+
+	return b, nil
+}
+
+// later queues work from an MQTT callback, publishing can take as long as
+// the publisher's timeouts and retries.
+func (b *bridge) later(what string, fn func()) {
+	select {
+	case b.work <- fn:
+	default:
+		log.Warn().Str("work", what).Msg("Too much MQTT work queued, dropping.")
+	}
+}
+
+func (b *bridge) publish(m message) {
+	log.Trace().Str("topic", m.topic).RawJSON("message", m.payload).Msg("Publishing to MQTT")
+	b.publisher.Publish(m.topic, b.cfg.MQTT.QoS, m.retained, m.payload)
+}
+
+// onConnect is called on every connection to the broker, including
+// reconnects, which may be to a broker that has lost its state.
+func (b *bridge) onConnect() {
+	log.Info().Msg("Connected to MQTT broker.")
+
+	if token := b.client.Subscribe(b.topics.commandSubscription(), 1, b.handleCommand); token.Wait() && token.Error() != nil {
+		log.Error().Err(token.Error()).Msg("Failed to subscribe to command topic.")
+	}
+
+	if token := b.client.Subscribe(b.topics.homeAssistantStatus(), 1, b.onHomeAssistantStatus); token.Wait() && token.Error() != nil {
+		log.Error().Err(token.Error()).Msg("Failed to subscribe to Home Assistant status topic.")
+	}
+
+	b.later("replay", func() {
+		b.bridgeOnline()
+		b.publisher.Replay()
+		b.replay(false)
+	})
+}
+
+// onHomeAssistantStatus replays everything Home Assistant needs to know
+// when it comes back online.
+func (b *bridge) onHomeAssistantStatus(_ string, payload []byte) {
+	if string(payload) != "online" {
+		return
+	}
+
+	log.Info().Msg("Home Assistant came online, replaying discovery.")
+
+	b.later("replay", func() {
+		b.replay(true)
+		b.bridgeOnline()
+	})
+}
+
+// bridgeOnline says the bridge is available, through the publisher so it's
+// queued if the broker doesn't acknowledge it. It's retained, as is the will,
+// so trackers discovered later aren't shown as unavailable.
+func (b *bridge) bridgeOnline() {
+	b.publisher.Publish(b.topics.availability(), b.cfg.MQTT.QoS, true, []byte("online"))
+}
+
+// replay publishes what the broker or Home Assistant may have forgotten,
+// from a copy so packets can be handled while it's being published.
+func (b *bridge) replay(withAttributes bool) {
+	var messages []message
+
+	b.mu.Lock()
+	for _, m := range b.discovery {
+		messages = append(messages, m...)
+	}
+
+	for _, m := range b.availability {
+		messages = append(messages, m)
+	}
+
+	if withAttributes {
+		for _, m := range b.attributes {
+			messages = append(messages, m)
+		}
+
+		for _, m := range b.health {
+			messages = append(messages, m)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, m := range messages {
+		b.publish(m)
+	}
+}
+
+func (b *bridge) handle(msg mqtt.Identifier) {
+	if d, ok := msg.(disconnected); ok {
+		b.offline(d.Identifier)
+		return
+	}
+
+	mqttID := msg.MQTTID()
+	deviceID := msg.Device()
+	data := deviceData(msg, b.cfg.Meta[deviceID].Name)
+
+	b.mu.Lock()
+	_, seen := b.discovery[deviceID]
+	device, changed := b.devices[deviceID], false
+
+	if d, ok := msg.(homeassistant.DeviceDescriber); ok {
+		changed = device.Merge(d.DescribeDevice())
+		b.devices[deviceID] = device
+	}
+
+	// The first reading of a measurement needs a sensor.
+	if r, ok := msg.(health.Reporter); ok {
+		for _, reading := range r.Readings() {
+			if !b.measurements[deviceID][reading.Measurement] {
+				if b.measurements[deviceID] == nil {
+					b.measurements[deviceID] = make(map[health.Measurement]bool)
+				}
+
+				b.measurements[deviceID][reading.Measurement] = true
+				changed = true
+			}
+		}
+	}
+
+	if !seen {
+		b.identities[mqttID] = data
+		b.commands[b.topics.render(kindCommand, data)] = mqttID
+	}
+	b.mu.Unlock()
+
+	if !seen || changed {
+		b.announce(msg, device)
+	}
+
+	b.online(msg, data)
+
+	if r, ok := msg.(command.Replier); ok {
+		if res := r.Reply(); res != nil {
+			if command.Resolve(mqttID, res) {
+				b.publishResult(mqttID, res)
+			} else {
+				log.Debug().Str("device", mqttID).Str("command", res.Command).Msg("Ignoring reply to unknown command.")
+			}
+		}
+	}
+
+	if a, ok := msg.(event.Alarmer); ok {
+		b.raise(msg, data, a.Alarms())
+	}
+
+	if r, ok := msg.(health.Reporter); ok {
+		b.report(msg, data, r.Readings())
+	}
+
+	if n, ok := msg.(voice.Noter); ok {
+		if note := n.VoiceNote(); note != nil {
+			b.publishVoice(data, note)
+		}
+	}
+
+	if msg.Valid() {
+		b.publishPosition(deviceID, data, msg.Location())
+	} else if u, ok := msg.(position.Updater); ok {
+		b.mu.Lock()
+		last := b.positions[deviceID]
+		b.mu.Unlock()
+
+		// Nothing to update until there's been a location.
+		if last != nil {
+			pos := *last
+			u.Update(&pos)
+			b.publishPosition(deviceID, data, &pos)
+		}
+	}
+}
+
+func (b *bridge) publishPosition(deviceID string, data topicData, pos *position.Position) {
+	payload, err := b.marshalPayload(kindAttributes, data, pos)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to marshal update message.")
+	}
+
+	m := message{
+		topic:   b.topics.render(kindAttributes, data),
+		payload: payload,
+	}
+
+	b.mu.Lock()
+	b.attributes[deviceID] = m
+	b.positions[deviceID] = pos
+	b.mu.Unlock()
+
+	b.publish(m)
+}
+
+// announce publishes the Home Assistant discovery configuration for a
+// tracker, device holds whatever the tracker has told us about itself.
+func (b *bridge) announce(msg mqtt.Identifier, device homeassistant.Device) {
+	mqttID := msg.MQTTID()
+	deviceID := msg.Device()
+
+	var messages []message
+
+	meta, has := b.cfg.Meta[deviceID]
+	if has && meta.Name != "" {
+		data := deviceData(msg, meta.Name)
+		attributesTopic := b.topics.render(kindAttributes, data)
+		availability := []homeassistant.Availability{
+			{Topic: b.topics.availability()},
+			{Topic: b.topics.render(kindDevice, data)},
+		}
+		uniqueID := "gps2mqtt_" + deviceID
+
+		device.Merge(homeassistant.Device{
+			Identifiers:  []string{uniqueID},
+			Name:         meta.Name,
+			Manufacturer: meta.Manufacturer,
+			Model:        meta.Model,
+			SWVersion:    meta.SWVersion,
+		})
+
+		hc := homeassistant.AutoConfiguration{
+			Name:                meta.Name,
+			Icon:                meta.Icon,
+			StateTopic:          b.topics.render(kindState, data),
+			Availability:        availability,
+			AvailabilityMode:    "all",
+			JSONAttributesTopic: attributesTopic,
+			SourceType:          "gps",
+			UniqueID:            uniqueID,
+			Device:              &device,
+		}
+
+		if b.cfg.MQTT.Payload == payloadEnvelope {
+			hc.JSONAttributesTemplate = "{{ " + b.valuePath() + " | tojson }}"
+		}
+
+		messages = append(messages, discoveryMessage(b.topics.discovery("device_tracker", mqttID), hc))
+
+		if s, ok := msg.(homeassistant.Sensorer); ok {
+			for _, sensor := range s.Sensors() {
+				sc := sensor.Configuration(meta.Name, uniqueID, attributesTopic, b.valuePath(), availability, &device)
+				messages = append(messages, discoveryMessage(b.topics.discovery("sensor", mqttID+"/"+sensor.Key), sc))
+			}
+		}
+
+		if a, ok := msg.(event.Alarmer); ok {
+			eventsTopic := b.topics.render(kindEvent, data)
+			valueTemplate := "{{ " + b.valuePath() + ".alarm }}"
+
+			for _, alarm := range a.SupportedAlarms() {
+				tc := homeassistant.AlarmTrigger(string(alarm), eventsTopic, valueTemplate, &device)
+				messages = append(messages, discoveryMessage(b.topics.discovery("device_trigger", mqttID+"/"+string(alarm)), tc))
+			}
+		}
+
+		for _, m := range b.reported(deviceID) {
+			sc := m.Sensor().Configuration(meta.Name, uniqueID, b.topics.health(data, m), b.valuePath(), availability, &device)
+			messages = append(messages, discoveryMessage(b.topics.discovery("sensor", mqttID+"/"+string(m)), sc))
+		}
+	}
+
+	b.mu.Lock()
+	b.discovery[deviceID] = messages
+	b.mu.Unlock()
+
+	for _, m := range messages {
+		b.publish(m)
+	}
+}
+
+func discoveryMessage(topic string, v interface{}) message {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to marshal configuration message.")
+	}
+
+	return message{
+		topic:    topic,
+		retained: true,
+		payload:  payload,
+	}
+}
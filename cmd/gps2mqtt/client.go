@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt"
+	"github.com/freman/gps2mqtt/publisher"
+)
+
+// messageHandler is called with messages arriving on a subscription.
+type messageHandler func(topic string, payload []byte)
+
+// client is the part of an MQTT client the bridge needs, so MQTT 3 and
+// MQTT 5 brokers can be used the same way.
+type client interface {
+	publisher.Client
+	Connect() paho.Token
+	Subscribe(topic string, qos byte, handler messageHandler) paho.Token
+	Disconnect(quiesce uint)
+}
+
+// newClient creates a client for the configured protocol version, will is
+// the topic "offline" is published to if the connection is lost and
+// onConnect is called on every connection, including reconnects.
+func newClient(cfg gps2mqtt.ConfigMQTT, will string, onConnect func()) (client, error) {
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, broker := range cfg.Brokers {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker %q: %w", broker, err)
+		}
+
+		if cfg.Username != "" && !secureScheme(u.Scheme) {
+			log.Warn().Str("broker", broker).Msg("MQTT credentials will be sent without TLS.")
+		}
+	}
+
+	switch cfg.ProtocolVersion {
+	case 0, 3, 4:
+		return newClient3(cfg, tlsCfg, will, onConnect), nil
+	case 5:
+		return newClient5(cfg, tlsCfg, will, onConnect)
+	}
+
+	return nil, fmt.Errorf("unsupported MQTT protocol version %d", cfg.ProtocolVersion)
+}
+
+func secureScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "ssl", "tls", "mqtts", "tcps", "wss":
+		return true
+	}
+
+	return false
+}
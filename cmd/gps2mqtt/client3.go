@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/tls"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/freman/gps2mqtt"
+)
+
+// client3 is an MQTT 3.1 or 3.1.1 client.
+type client3 struct {
+	paho.Client
+}
+
+func newClient3(cfg gps2mqtt.ConfigMQTT, tlsCfg *tls.Config, will string, onConnect func()) *client3 {
+	opts := paho.NewClientOptions().
+		SetClientID(cfg.ClientName).
+		SetKeepAlive(cfg.KeepAlive).
+		SetPingTimeout(cfg.PingTimeout).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetProtocolVersion(cfg.ProtocolVersion).
+		SetTLSConfig(tlsCfg).
+		SetWill(will, "offline", 0, true).
+		SetOnConnectHandler(func(paho.Client) { onConnect() }).
+		SetConnectRetry(true)
+
+	if cfg.Username != "" && cfg.Password != "" {
+		opts.SetUsername(cfg.Username)
+		opts.SetPassword(cfg.Password)
+	}
+
+	for _, broker := range cfg.Brokers {
+		opts.AddBroker(broker)
+	}
+
+	return &client3{paho.NewClient(opts)}
+}
+
+func (c *client3) Subscribe(topic string, qos byte, handler messageHandler) paho.Token {
+	return c.Client.Subscribe(topic, qos, func(_ paho.Client, m paho.Message) {
+		handler(m.Topic(), m.Payload())
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	paho5 "github.com/eclipse/paho.golang/paho"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt"
+)
+
+// client5 is an MQTT 5 client, adding message expiry and user properties
+// to what is published.
+type client5 struct {
+	cfg    autopaho.ClientConfig
+	expiry *uint32
+	user   paho5.UserProperties
+	router *paho5.StandardRouter
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	connected atomic.Bool
+
+	mu         sync.Mutex
+	cm         *autopaho.ConnectionManager
+	subscribed map[string]bool
+}
+
+func newClient5(cfg gps2mqtt.ConfigMQTT, tlsCfg *tls.Config, will string, onConnect func()) (*client5, error) {
+	c := &client5{
+		router:     paho5.NewStandardRouter(),
+		subscribed: make(map[string]bool),
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	if cfg.MessageExpiry > 0 {
+		expiry := uint32(cfg.MessageExpiry.Seconds())
+		c.expiry = &expiry
+	}
+
+	for k, v := range cfg.UserProperties {
+		c.user.Add(k, v)
+	}
+
+	for _, broker := range cfg.Brokers {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker %q: %w", broker, err)
+		}
+
+		c.cfg.ServerUrls = append(c.cfg.ServerUrls, u)
+	}
+
+	c.cfg.TlsCfg = tlsCfg
+	c.cfg.KeepAlive = uint16(cfg.KeepAlive.Seconds())
+	c.cfg.ConnectTimeout = cfg.ConnectTimeout
+	c.cfg.CleanStartOnInitialConnection = true
+	c.cfg.ClientID = cfg.ClientName
+	c.cfg.SetWillMessage(will, []byte("offline"), 0, true)
+
+	if cfg.Username != "" && cfg.Password != "" {
+		c.cfg.SetUsernamePassword(cfg.Username, []byte(cfg.Password))
+	}
+
+	c.cfg.OnConnectionUp = func(cm *autopaho.ConnectionManager, _ *paho5.Connack) {
+		c.mu.Lock()
+		c.cm = cm
+		c.mu.Unlock()
+
+		c.connected.Store(true)
+		onConnect()
+	}
+
+	c.cfg.OnConnectError = func(err error) {
+		c.connected.Store(false)
+		log.Warn().Err(err).Msg("Failed to connect to MQTT broker.")
+	}
+
+	c.cfg.OnClientError = func(err error) {
+		c.connected.Store(false)
+		log.Warn().Err(err).Msg("Lost connection to MQTT broker.")
+	}
+
+	c.cfg.OnServerDisconnect = func(d *paho5.Disconnect) {
+		c.connected.Store(false)
+		log.Warn().Uint8("reason", d.ReasonCode).Msg("Disconnected by MQTT broker.")
+	}
+
+	c.cfg.OnPublishReceived = []func(paho5.PublishReceived) (bool, error){
+		func(pr paho5.PublishReceived) (bool, error) {
+			c.router.Route(pr.Packet.Packet())
+			return true, nil
+		},
+	}
+
+	return c, nil
+}
+
+func (c *client5) Connect() paho.Token {
+	return newToken(func() error {
+		cm, err := autopaho.NewConnection(c.ctx, c.cfg)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.cm = cm
+		c.mu.Unlock()
+
+		return cm.AwaitConnection(c.ctx)
+	})
+}
+
+func (c *client5) IsConnectionOpen() bool {
+	return c.connected.Load()
+}
+
+func (c *client5) manager() (*autopaho.ConnectionManager, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cm == nil {
+		return nil, errNotConnected
+	}
+
+	return c.cm, nil
+}
+
+func (c *client5) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	return newToken(func() error {
+		cm, err := c.manager()
+		if err != nil {
+			return err
+		}
+
+		p := &paho5.Publish{
+			Topic:  topic,
+			QoS:    qos,
+			Retain: retained,
+			Properties: &paho5.PublishProperties{
+				User: c.user,
+			},
+		}
+
+		switch v := payload.(type) {
+		case []byte:
+			p.Payload = v
+		case string:
+			p.Payload = []byte(v)
+		default:
+			return fmt.Errorf("unsupported payload type %T", payload)
+		}
+
+		// Retained messages are the discovery configuration, which has to
+		// outlive any expiry.
+		if !retained {
+			p.Properties.MessageExpiry = c.expiry
+		}
+
+		_, err = cm.Publish(c.ctx, p)
+		return err
+	})
+}
+
+func (c *client5) Subscribe(topic string, qos byte, handler messageHandler) paho.Token {
+	c.mu.Lock()
+	if !c.subscribed[topic] {
+		c.subscribed[topic] = true
+		c.router.RegisterHandler(topic, func(p *paho5.Publish) {
+			handler(p.Topic, p.Payload)
+		})
+	}
+	c.mu.Unlock()
+
+	return newToken(func() error {
+		cm, err := c.manager()
+		if err != nil {
+			return err
+		}
+
+		_, err = cm.Subscribe(c.ctx, &paho5.Subscribe{
+			Subscriptions: []paho5.SubscribeOptions{{Topic: topic, QoS: qos}},
+		})
+
+		return err
+	})
+}
+
+func (c *client5) Disconnect(quiesce uint) {
+	defer c.cancel()
+
+	cm, err := c.manager()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(quiesce)*time.Millisecond)
+	defer cancel()
+
+	if err := cm.Disconnect(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to disconnect from MQTT broker.")
+	}
+
+	c.connected.Store(false)
+}
+
+var errNotConnected = errors.New("not connected to broker")
+
+// token is a paho.Token for work done in the background.
+type token struct {
+	done chan struct{}
+	err  error
+}
+
+func newToken(fn func() error) *token {
+	t := &token{done: make(chan struct{})}
+
+	go func() {
+		t.err = fn()
+		close(t.done)
+	}()
+
+	return t
+}
+
+func (t *token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *token) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+// handleCommand is the MQTT callback for commands, which are sent to the
+// device and their results published in the order they arrived.
+func (b *bridge) handleCommand(topic string, payload []byte) {
+	b.later("command", func() {
+		b.sendCommand(topic, payload)
+	})
+}
+
+func (b *bridge) sendCommand(topic string, payload []byte) {
+	b.mu.Lock()
+	mqttID, known := b.commands[topic]
+	b.mu.Unlock()
+
+	if !known {
+		log.Warn().Str("topic", topic).Msg("Ignoring command for unknown device.")
+		return
+	}
+
+	logger := log.With().Str("device", mqttID).Logger()
+
+	res := &command.Result{
+		Status:    command.StatusSent,
+		Timestamp: time.Now(),
+	}
+
+	cmd, err := command.Parse(payload)
+	if err == nil {
+		res.ID = cmd.ID
+		res.Command = cmd.Command
+
+		err = command.Send(mqttID, cmd)
+	}
+
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to send command to device.")
+
+		res.Status = command.StatusError
+		res.Error = err.Error()
+	} else {
+		logger.Info().Str("command", cmd.Command).Msg("Sent command to device.")
+	}
+
+	b.publishResult(mqttID, res)
+}
+
+func (b *bridge) publishResult(mqttID string, res *command.Result) {
+	b.mu.Lock()
+	data := b.identities[mqttID]
+	b.mu.Unlock()
+
+	payload, err := b.marshalPayload(kindResult, data, res)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal command result.")
+		return
+	}
+
+	b.publish(message{
+		topic:   b.topics.render(kindResult, data),
+		payload: payload,
+	})
+}
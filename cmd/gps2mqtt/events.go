@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// raise publishes an event for each alarm that wasn't already active for
+// the tracker, trackers tend to repeat an alarm until it is cleared.
+func (b *bridge) raise(msg mqtt.Identifier, data topicData, alarms []event.Alarm) {
+	deviceID := msg.Device()
+
+	active := make(map[event.Alarm]bool, len(alarms))
+	for _, alarm := range alarms {
+		active[alarm] = true
+	}
+
+	b.mu.Lock()
+	previous := b.alarms[deviceID]
+	b.alarms[deviceID] = active
+	b.mu.Unlock()
+
+	for alarm := range active {
+		if previous[alarm] {
+			continue
+		}
+
+		log.Info().Str("device", msg.MQTTID()).Str("alarm", string(alarm)).Msg("Device raised an alarm.")
+
+		payload, err := b.marshalPayload(kindEvent, data, event.New(msg, alarm))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal event.")
+			continue
+		}
+
+		b.publish(message{
+			topic:   b.topics.render(kindEvent, data),
+			payload: payload,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt/health"
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// report publishes each health reading to its measurement's topic,
+// remembering them to publish again when Home Assistant comes back.
+func (b *bridge) report(msg mqtt.Identifier, data topicData, readings []health.Reading) {
+	received := time.Now()
+
+	for _, reading := range readings {
+		payload, err := b.marshalPayload(kindHealth, data, health.New(msg, reading, received))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal health reading.")
+			continue
+		}
+
+		m := message{
+			topic:   b.topics.health(data, reading.Measurement),
+			payload: payload,
+		}
+
+		b.mu.Lock()
+		b.health[m.topic] = m
+		b.mu.Unlock()
+
+		b.publish(m)
+	}
+}
+
+// reported returns the measurements a tracker has reported, in order.
+func (b *bridge) reported(deviceID string) []health.Measurement {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	measurements := make([]health.Measurement, 0, len(b.measurements[deviceID]))
+	for m := range b.measurements[deviceID] {
+		measurements = append(measurements, m)
+	}
+
+	sort.Slice(measurements, func(i, j int) bool {
+		return measurements[i] < measurements[j]
+	})
+
+	return measurements
+}
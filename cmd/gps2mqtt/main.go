@@ -1,19 +1,22 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/freman/gps2mqtt"
-	"github.com/freman/gps2mqtt/homeassistant"
 	"github.com/freman/gps2mqtt/mqtt"
 	"github.com/freman/gps2mqtt/protocol"
+	"github.com/freman/gps2mqtt/publisher"
 	"github.com/freman/gps2mqtt/status"
 
 	_ "github.com/freman/gps2mqtt/protocol/gt06"
@@ -39,27 +42,43 @@ func main() {
 
 	chMessage := make(chan mqtt.Identifier, 10)
 
-	opts := paho.NewClientOptions().
-		SetClientID(cfg.MQTT.ClientName).
-		SetKeepAlive(cfg.MQTT.KeepAlive).
-		SetPingTimeout(cfg.MQTT.PingTimeout)
+	b, err := newBridge(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid MQTT configuration.")
+	}
 
-	if cfg.MQTT.Username != "" && cfg.MQTT.Password != "" {
-		opts.SetUsername(cfg.MQTT.Username)
-		opts.SetPassword(cfg.MQTT.Password)
+	c, err := newClient(cfg.MQTT, b.topics.availability(), b.onConnect)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid MQTT configuration.")
 	}
 
-	for _, broker := range cfg.MQTT.Brokers {
-		opts.AddBroker(broker)
+	b.client = c
+
+	b.publisher, err = publisher.New(log.Logger, c, publisher.Config{
+		Directory:   cfg.MQTT.Queue.Directory,
+		MaxMessages: cfg.MQTT.Queue.MaxMessages,
+		Timeout:     cfg.MQTT.Queue.PublishTimeout,
+		Retries:     cfg.MQTT.Queue.Retries,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open publish queue.")
 	}
 
-	opts.SetWill("gps2mqtt/availability", "offline", 0, false)
+	status.SetQueueDepth(b.publisher.Depth)
+	status.SetDisconnectHandler(func(last mqtt.Identifier) {
+		chMessage <- disconnected{last}
+	})
 
-	c := paho.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
+	// Keep trying in the background if the broker isn't reachable, anything
+	// published in the mean time is queued.
+	if token := c.Connect(); !token.WaitTimeout(cfg.MQTT.Queue.PublishTimeout) {
+		log.Warn().Msg("Unable to connect to MQTT Broker yet, will keep trying.")
+	} else if token.Error() != nil {
 		log.Fatal().Err(token.Error()).Msg("Failed to connect to MQTT Broker.")
 	}
 
+	listeners := make(map[string]map[string]protocol.Interface)
+
 	for i := range cfg.Protocols {
 		p := protocol.Get(i)
 		if p == nil {
@@ -70,64 +89,110 @@ func main() {
 			log.Fatal().Str("protocol", i).Err(err).Msg("GPS protocol configuration failed.")
 		}
 
-		go p.Run(chMessage)
+		listen, err := listenAddress(p.Address())
+		if err != nil {
+			log.Fatal().Str("protocol", i).Err(err).Msg("Invalid listen address.")
+		}
+
+		if listeners[listen] == nil {
+			listeners[listen] = make(map[string]protocol.Interface)
+		}
+
+		listeners[listen][i] = p
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	for listen, protocols := range listeners {
+		var runner interface {
+			Run(context.Context, chan mqtt.Identifier) error
+		}
+
+		if len(protocols) == 1 {
+			for _, p := range protocols {
+				runner = p
+			}
+		} else {
+			runner = protocol.NewMux(log.Logger, listen, protocols)
+		}
+
+		wg.Add(1)
+
+		go func(listen string) {
+			defer wg.Done()
+
+			if err := runner.Run(ctx, chMessage); err != nil {
+				log.Fatal().Str("listen", listen).Err(err).Msg("Listener failed.")
+			}
+		}(listen)
 	}
 
+	var statusServer *http.Server
+
 	if cfg.Status.Enabled {
-		http.HandleFunc("/", status.HandleRequest)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", status.HandleRequest)
+		mux.HandleFunc("/queue", status.HandleQueueRequest)
+
+		statusServer = &http.Server{
+			Addr:    cfg.Status.Listen,
+			Handler: mux,
+		}
+
 		go func() {
 			log.Info().Str("listen", cfg.Status.Listen).Msg("Starting status listener")
-			if err := http.ListenAndServe(cfg.Status.Listen, nil); err != nil {
+			if err := statusServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				log.Fatal().Err(err).Msg("Unable to start status listener")
 			}
 		}()
 	}
 
-	c.Publish("gps2mqtt/availability", 0, false, "online") // TODO error check
+	go func() {
+		<-ctx.Done()
+		log.Info().Msg("Shutting down, no longer accepting connections.")
 
-	seen := make(map[string]struct{})
+		// Everything must have stopped accepting before draining, once drained
+		// nothing is left to send messages.
+		wg.Wait()
+		protocol.Drain(cfg.ShutdownTimeout)
+		close(chMessage)
+	}()
 
 	for msg := range chMessage {
-		mqttID := msg.MQTTID()
-		topicPrefix := "gps2mqtt/device/" + mqttID
-		deviceID := msg.Device()
-
-		if _, has := seen[deviceID]; !has {
-			seen[deviceID] = struct{}{}
-
-			meta, has := cfg.Meta[deviceID]
-			if has && meta.Name != "" {
-				hc := homeassistant.AutoConfiguration{
-					Name:                meta.Name,
-					Icon:                meta.Icon,
-					StateTopic:          topicPrefix,
-					AvailabilityTopic:   "gps2mqtt/availability",
-					JSONAttributesTopic: topicPrefix + "/attributes",
-					SourceType:          "gps",
-					UniqueID:            "gps2mqtt_" + deviceID,
-				}
-
-				b, err := json.Marshal(hc)
-				if err != nil {
-					log.Fatal().Err(err).Msg("Failed to marshal configuration message.")
-				}
-
-				topic := "homeassistant/device_tracker/" + mqttID + "/config"
-				log.Trace().Str("topic", topic).RawJSON("message", b).Msg("Publishing config to MQTT")
-
-				c.Publish(topic, 0, true, b) // TODO error check
-			}
-		}
+		b.handle(msg)
+	}
 
-		if msg.Valid() {
-			b, err := json.Marshal(msg)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to marshal update message.")
-			}
+	if statusServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
 
-			topic := topicPrefix + "/attributes"
-			log.Trace().Str("topic", topic).RawJSON("message", b).Msg("Publishing location to MQTT")
-			c.Publish(topic, 0, false, b) // TODO error check
+		if err := statusServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Failed to stop status listener.")
 		}
 	}
+
+	if token := c.Publish(b.topics.availability(), 0, true, "offline"); !token.WaitTimeout(cfg.ShutdownTimeout) || token.Error() != nil {
+		log.Error().Err(token.Error()).Msg("Failed to publish offline availability.")
+	}
+
+	c.Disconnect(uint(cfg.ShutdownTimeout.Milliseconds()))
+	log.Info().Msg("Shutdown complete.")
+}
+
+// listenAddress normalises address so protocols sharing a port are muxed
+// however the address was written, listening on every address is :port.
+func listenAddress(address string) (string, error) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return "", err
+	}
+
+	if addr.IP.IsUnspecified() {
+		addr.IP = nil
+	}
+
+	return addr.String(), nil
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenAddress(t *testing.T) {
+	for _, test := range []struct {
+		address  string
+		expected string
+	}{
+		{":5093", ":5093"},
+		{"0.0.0.0:5093", ":5093"},
+		{"[::]:5093", ":5093"},
+		{"127.0.0.1:5093", "127.0.0.1:5093"},
+	} {
+		listen, err := listenAddress(test.address)
+		assert.NoError(t, err, test.address)
+		assert.Equal(t, test.expected, listen, test.address)
+	}
+
+	_, err := listenAddress("5093")
+	assert.Error(t, err)
+}
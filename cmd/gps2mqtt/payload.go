@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	payloadPacket   = "packet"
+	payloadEnvelope = "envelope"
+)
+
+// envelope wraps a payload with enough information to identify where it
+// came from without having to look at the topic.
+type envelope struct {
+	ID        string      `json:"id"`
+	Device    string      `json:"device"`
+	Protocol  string      `json:"protocol"`
+	Name      string      `json:"name,omitempty"`
+	Kind      string      `json:"kind"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// marshalPayload encodes v using the configured payload layout.
+func (b *bridge) marshalPayload(kind string, data topicData, v interface{}) ([]byte, error) {
+	if b.cfg.MQTT.Payload != payloadEnvelope {
+		return json.Marshal(v)
+	}
+
+	return json.Marshal(envelope{
+		ID:        data.ID,
+		Device:    data.Device,
+		Protocol:  data.Protocol,
+		Name:      data.Name,
+		Kind:      kind,
+		Timestamp: time.Now(),
+		Data:      v,
+	})
+}
+
+// valuePath is where attributes can be found in the payload by Home
+// Assistant templates.
+func (b *bridge) valuePath() string {
+	if b.cfg.MQTT.Payload == payloadEnvelope {
+		return "value_json.data"
+	}
+
+	return "value_json"
+}
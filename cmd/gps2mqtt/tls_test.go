@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freman/gps2mqtt"
+)
+
+// writeCertificate writes a self signed certificate and its key as PEM.
+func writeCertificate(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	caFile, _ := writeCertificate(t, dir, "ca")
+	certFile, keyFile := writeCertificate(t, dir, "client")
+
+	// A bundle of both certificates.
+	ca, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	client, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	require.NoError(t, os.WriteFile(bundle, append(ca, client...), 0o600))
+
+	cfg, err := newTLSConfig(gps2mqtt.ConfigTLS{CAFile: bundle, CertFile: certFile, KeyFile: keyFile, ServerName: "broker"})
+	if assert.NoError(t, err) {
+		assert.Len(t, cfg.RootCAs.Subjects(), 2) //nolint:staticcheck // Only the count matters.
+		assert.Len(t, cfg.Certificates, 1)
+		assert.Equal(t, "broker", cfg.ServerName)
+	}
+
+	cfg, err = newTLSConfig(gps2mqtt.ConfigTLS{})
+	if assert.NoError(t, err) {
+		assert.Nil(t, cfg.RootCAs)
+		assert.Empty(t, cfg.Certificates)
+	}
+
+	for name, tlsCfg := range map[string]gps2mqtt.ConfigTLS{
+		"missing CA":          {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA without certs":    {CAFile: keyFile},
+		"missing certificate": {CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile},
+		"missing key":         {CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")},
+		"mismatched key pair": {CertFile: caFile, KeyFile: keyFile},
+		"certificate only":    {CertFile: certFile},
+		"key only":            {KeyFile: keyFile},
+	} {
+		_, err := newTLSConfig(tlsCfg)
+		assert.Error(t, err, name)
+	}
+}
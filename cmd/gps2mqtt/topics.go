@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/freman/gps2mqtt"
+	"github.com/freman/gps2mqtt/health"
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+const (
+	kindState        = "state"
+	kindAttributes   = "attributes"
+	kindCommand      = "command"
+	kindResult       = "result"
+	kindAvailability = "availability"
+	kindDevice       = "device_availability"
+	kindEvent        = "event"
+	kindVoice        = "voice"
+	kindHealth       = "health"
+)
+
+// topicData is what topic templates are executed with.
+type topicData struct {
+	Client   string
+	ID       string
+	Device   string
+	Protocol string
+	Name     string
+	Kind     string
+}
+
+type topics struct {
+	client          string
+	discoveryPrefix string
+	templates       map[string]*template.Template
+}
+
+func newTopics(cfg gps2mqtt.ConfigMQTT) (*topics, error) {
+	t := &topics{
+		client:          cfg.ClientName,
+		discoveryPrefix: strings.TrimSuffix(cfg.DiscoveryPrefix, "/"),
+		templates:       make(map[string]*template.Template),
+	}
+
+	for kind, pattern := range map[string]string{
+		kindState:        cfg.Topics.State,
+		kindAttributes:   cfg.Topics.Attributes,
+		kindCommand:      cfg.Topics.Command,
+		kindResult:       cfg.Topics.Result,
+		kindAvailability: cfg.Topics.Availability,
+		kindDevice:       cfg.Topics.DeviceAvailability,
+		kindEvent:        cfg.Topics.Events,
+		kindVoice:        cfg.Topics.Voice,
+		kindHealth:       cfg.Topics.Health,
+	} {
+		tmpl, err := template.New(kind).Option("missingkey=error").Parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s topic: %w", kind, err)
+		}
+
+		t.templates[kind] = tmpl
+	}
+
+	// Make sure every template can be rendered before they're needed.
+	for kind := range t.templates {
+		if _, err := t.execute(kind, topicData{}); err != nil {
+			return nil, fmt.Errorf("invalid %s topic: %w", kind, err)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *topics) execute(kind string, data topicData) (string, error) {
+	data.Client = t.client
+	data.Kind = kind
+
+	var sb strings.Builder
+	if err := t.templates[kind].Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func (t *topics) render(kind string, data topicData) string {
+	// Templates were checked when loaded, so this can't fail on the fields.
+	topic, _ := t.execute(kind, data)
+	return topic
+}
+
+// deviceData describes a tracker for the topic templates, name being the
+// name given in its meta block.
+func deviceData(msg mqtt.Identifier, name string) topicData {
+	return topicData{
+		ID:       msg.MQTTID(),
+		Device:   msg.Device(),
+		Protocol: msg.Protocol(),
+		Name:     name,
+	}
+}
+
+func (t *topics) availability() string {
+	return t.render(kindAvailability, topicData{})
+}
+
+// commandSubscription is the command topic with every device field replaced
+// by a single level wildcard.
+func (t *topics) commandSubscription() string {
+	return t.render(kindCommand, topicData{
+		ID:       "+",
+		Device:   "+",
+		Protocol: "+",
+		Name:     "+",
+	})
+}
+
+// health is where readings of a measurement are published, under the
+// health topic.
+func (t *topics) health(data topicData, m health.Measurement) string {
+	return t.render(kindHealth, data) + "/" + string(m)
+}
+
+func (t *topics) discovery(component, objectID string) string {
+	return t.discoveryPrefix + "/" + component + "/" + objectID + "/config"
+}
+
+func (t *topics) homeAssistantStatus() string {
+	return t.discoveryPrefix + "/status"
+}
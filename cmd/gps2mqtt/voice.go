@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/freman/gps2mqtt/voice"
+)
+
+// publishVoice announces a voice note saved from a tracker.
+func (b *bridge) publishVoice(data topicData, note *voice.Note) {
+	log.Info().Str("device", data.ID).Str("file", note.File).Msg("Device sent a voice note.")
+
+	payload, err := b.marshalPayload(kindVoice, data, note)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal voice note.")
+		return
+	}
+
+	b.publish(message{
+		topic:   b.topics.render(kindVoice, data),
+		payload: payload,
+	})
+}
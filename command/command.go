@@ -0,0 +1,79 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	StatusSent  = "sent"
+	StatusError = "error"
+	StatusReply = "reply"
+)
+
+var ErrNotConnected = errors.New("device is not connected")
+
+// Command is a request, received over MQTT, to send something to a device.
+type Command struct {
+	ID      string   `json:"id,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Result reports what happened to a command, either when it was written to
+// the device or when the device replied to it.
+type Result struct {
+	ID        string    `json:"id,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Response  string    `json:"response,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Encoder turns a command into the bytes a specific device understands.
+type Encoder interface {
+	Encode(cmd Command) ([]byte, error)
+}
+
+// Replier is implemented by packets that may carry a device's reply to a
+// command, Reply returns nil if the packet isn't a reply.
+type Replier interface {
+	Reply() *Result
+}
+
+// Parse decodes an MQTT payload into a command, payloads that are not JSON
+// objects are treated as the raw command text.
+func Parse(payload []byte) (Command, error) {
+	var cmd Command
+
+	trimmed := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			return cmd, err
+		}
+	} else {
+		cmd.Command = trimmed
+	}
+
+	if cmd.Command == "" {
+		return cmd, errors.New("empty command")
+	}
+
+	return cmd, nil
+}
+
+// Name returns the command keyword, which is everything up to the first comma
+// when the arguments were sent as part of the command text.
+func (c Command) Name() string {
+	name, _, _ := strings.Cut(c.Command, ",")
+	return name
+}
+
+// Text joins the command and its arguments with commas, which is how most
+// of the text based protocols expect to see them.
+func (c Command) Text() string {
+	return strings.Join(append([]string{c.Command}, c.Args...), ",")
+}
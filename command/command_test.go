@@ -0,0 +1,115 @@
+package command
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cmd, err := Parse([]byte(`{"id":"abc","command":"UPLOAD","args":["600"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Command{ID: "abc", Command: "UPLOAD", Args: []string{"600"}}, cmd)
+	assert.Equal(t, "UPLOAD", cmd.Name())
+	assert.Equal(t, "UPLOAD,600", cmd.Text())
+
+	cmd, err = Parse([]byte("RELAY,1#\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Command: "RELAY,1#"}, cmd)
+	assert.Equal(t, "RELAY", cmd.Name())
+
+	_, err = Parse([]byte(`{"id":"abc"}`))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte(`{"command":`))
+	assert.Error(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	s := &session{
+		pending: []Command{
+			{ID: "1", Command: "UPLOAD,600"},
+			{ID: "2", Command: "CR"},
+		},
+	}
+
+	r.devices["test"] = s
+	defer delete(r.devices, "test")
+
+	res := &Result{Command: "CR"}
+	assert.True(t, Resolve("test", res))
+	assert.Equal(t, "2", res.ID)
+
+	res = &Result{Command: "CR"}
+	assert.False(t, Resolve("test", res))
+
+	res = &Result{Command: "upload"}
+	assert.True(t, Resolve("test", res))
+	assert.Equal(t, "1", res.ID)
+	assert.Equal(t, "UPLOAD,600", res.Command)
+
+	assert.False(t, Resolve("missing", &Result{}))
+}
+
+type rawEncoder struct{}
+
+func (rawEncoder) Encode(cmd Command) ([]byte, error) {
+	return []byte(cmd.Command), nil
+}
+
+func TestWrite(t *testing.T) {
+	device, server := net.Pipe()
+	defer device.Close()
+
+	Register(testID{id: "write"}, server, rawEncoder{}, time.Second)
+	defer Unregister(server)
+
+	started := make(chan struct{})
+	responded := make(chan error, 1)
+
+	// A response written in two parts is held together while a command is
+	// sent.
+	go func() {
+		responded <- Write(server, time.Second, func(w io.Writer) error {
+			close(started)
+
+			if _, err := w.Write([]byte("[re")); err != nil {
+				return err
+			}
+
+			time.Sleep(10 * time.Millisecond)
+
+			_, err := w.Write([]byte("sponse]"))
+			return err
+		})
+	}()
+
+	<-started
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- Send("write", Command{Command: "[command]"})
+	}()
+
+	b := make([]byte, len("[response][command]"))
+	_, err := io.ReadFull(device, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "[response][command]", string(b))
+	assert.NoError(t, <-responded)
+	assert.NoError(t, <-sent)
+}
+
+// testID is just enough of a packet to register.
+type testID struct {
+	mqtt.Identifier
+
+	id string
+}
+
+func (t testID) MQTTID() string {
+	return t.id
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// maxPending is the number of unanswered commands remembered per device.
+const maxPending = 16
+
+type session struct {
+	mu sync.Mutex
+
+	writer       *writer
+	encoder      Encoder
+	writeTimeout time.Duration
+	pending      []Command
+}
+
+// writer serialises writes to a connection, commands are sent from MQTT
+// while the listener is responding to the device.
+type writer struct {
+	mu sync.Mutex
+
+	conn net.Conn
+}
+
+type registry struct {
+	mu sync.RWMutex
+
+	devices map[string]*session
+	writers map[net.Conn]*writer
+}
+
+var r = registry{
+	devices: map[string]*session{},
+	writers: map[net.Conn]*writer{},
+}
+
+// writerFor returns the writer for conn, creating it if need be.
+func writerFor(conn net.Conn) *writer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, has := r.writers[conn]
+	if !has {
+		w = &writer{conn: conn}
+		r.writers[conn] = w
+	}
+
+	return w
+}
+
+// write holds the connection to itself, with a write deadline, while fn
+// writes to it.
+func (w *writer) write(timeout time.Duration, fn func(io.Writer) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	err := fn(w.conn)
+
+	if clearErr := w.conn.SetWriteDeadline(time.Time{}); err == nil {
+		err = clearErr
+	}
+
+	return err
+}
+
+// Write lets fn write to conn without commands being written in between,
+// listeners use it to respond to devices.
+func Write(conn net.Conn, timeout time.Duration, fn func(io.Writer) error) error {
+	return writerFor(conn).write(timeout, fn)
+}
+
+// Register makes a device's connection available for sending commands, it
+// replaces any previous connection for the same device.
+func Register(id mqtt.Identifier, conn net.Conn, encoder Encoder, writeTimeout time.Duration) {
+	w := writerFor(conn)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.devices[id.MQTTID()] = &session{
+		writer:       w,
+		encoder:      encoder,
+		writeTimeout: writeTimeout,
+	}
+}
+
+// Unregister forgets every device using the given connection.
+func Unregister(conn net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.devices {
+		if s.writer.conn == conn {
+			delete(r.devices, id)
+		}
+	}
+
+	delete(r.writers, conn)
+}
+
+// Send encodes and writes a command to the device identified by mqttID.
+func Send(mqttID string, cmd Command) error {
+	r.mu.RLock()
+	s, has := r.devices[mqttID]
+	r.mu.RUnlock()
+
+	if !has {
+		return ErrNotConnected
+	}
+
+	b, err := s.encoder.Encode(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = s.writer.write(s.writeTimeout, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, cmd)
+	if len(s.pending) > maxPending {
+		s.pending = s.pending[1:]
+	}
+
+	return nil
+}
+
+// Resolve matches a reply from a device with the oldest pending command of
+// the same name, filling in the command ID. It returns false if no command
+// was waiting for the reply.
+func Resolve(mqttID string, res *Result) bool {
+	r.mu.RLock()
+	s, has := r.devices[mqttID]
+	r.mu.RUnlock()
+
+	if !has {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, cmd := range s.pending {
+		if res.Command == "" || strings.EqualFold(cmd.Name(), res.Command) {
+			res.ID = cmd.ID
+			res.Command = cmd.Command
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
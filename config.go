@@ -15,6 +15,10 @@ type Config struct {
 	Status    ConfigStatus
 	Meta      map[string]ConfigMeta
 	Protocols map[string]toml.Primitive `toml:"protocol"`
+
+	// ShutdownTimeout is how long connected trackers are given to finish
+	// what they're sending, and MQTT given to flush, when shutting down.
+	ShutdownTimeout time.Duration
 }
 
 type ConfigMQTT struct {
@@ -24,6 +28,75 @@ type ConfigMQTT struct {
 	PingTimeout time.Duration
 	Username    string
 	Password    string
+
+	// ConnectTimeout is how long connecting to the broker, TLS handshake
+	// included, can take.
+	ConnectTimeout time.Duration
+
+	// ProtocolVersion is 3 for MQTT 3.1, 4 for MQTT 3.1.1 or 5 for MQTT 5,
+	// left at 0 MQTT 3.1.1 is tried first falling back to 3.1.
+	ProtocolVersion uint
+	TLS             ConfigTLS
+
+	// MessageExpiry and UserProperties are sent with every publish that
+	// isn't retained, only when using MQTT 5.
+	MessageExpiry  time.Duration
+	UserProperties map[string]string
+
+	// QoS used when publishing, 1 (the default) or more is needed for the
+	// queue to know messages made it to the broker.
+	QoS   byte
+	Queue ConfigQueue
+
+	// DiscoveryPrefix is the topic Home Assistant looks for discovery
+	// messages under.
+	DiscoveryPrefix string
+	Topics          ConfigTopics
+
+	// Payload is either "packet" to publish the position (or event or
+	// result) on its own, or "envelope" to wrap it with the device,
+	// protocol, name and kind.
+	Payload string
+}
+
+// ConfigTopics holds text/template patterns for each of the topics used,
+// they are given .Client, .ID, .Device, .Protocol, .Name and .Kind.
+type ConfigTopics struct {
+	State        string
+	Attributes   string
+	Command      string
+	Result       string
+	Availability string
+	// DeviceAvailability is where each tracker's own online/offline is published.
+	DeviceAvailability string
+	// Events is where alarms raised by trackers are published.
+	Events string
+	// Voice is where voice notes saved from trackers are announced.
+	Voice string
+	// Health is where health readings are published, each measurement
+	// under its own topic (eg .../health/heart_rate).
+	Health string
+}
+
+// ConfigTLS is used for ssl://, tls:// and wss:// brokers.
+type ConfigTLS struct {
+	// CAFile is a PEM bundle of authorities to trust instead of the system ones.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name expected in the broker's certificate.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type ConfigQueue struct {
+	// Directory unsent messages are spooled to, if empty they are only
+	// kept in memory and lost on restart.
+	Directory      string
+	MaxMessages    int
+	PublishTimeout time.Duration
+	Retries        int
 }
 
 type ConfigStatus struct {
@@ -34,21 +107,51 @@ type ConfigStatus struct {
 type ConfigMeta struct {
 	Name string
 	Icon string
+
+	// Override what the tracker reports about itself in Home Assistant.
+	Manufacturer string
+	Model        string
+	SWVersion    string
+
+	// AvailabilityTimeout marks the tracker offline if it hasn't sent
+	// anything for this long, even if it is still connected.
+	AvailabilityTimeout time.Duration
 }
 
 func LoadConfiguration(file string) (*Config, error) {
 	config := Config{
 		MQTT: ConfigMQTT{
-			ClientName:  "gps2mqtt",
-			KeepAlive:   time.Minute,
-			PingTimeout: time.Second,
-			Username:    os.Getenv("MQTT_USERNAME"),
-			Password:    os.Getenv("MQTT_PASSWORD"),
+			ClientName:     "gps2mqtt",
+			KeepAlive:      time.Minute,
+			PingTimeout:    time.Second,
+			ConnectTimeout: 30 * time.Second,
+			QoS:            1,
+			Username:       os.Getenv("MQTT_USERNAME"),
+			Password:       os.Getenv("MQTT_PASSWORD"),
+			Queue: ConfigQueue{
+				MaxMessages:    10000,
+				PublishTimeout: 5 * time.Second,
+				Retries:        2,
+			},
+			DiscoveryPrefix: "homeassistant",
+			Topics: ConfigTopics{
+				State:              "gps2mqtt/device/{{.ID}}",
+				Attributes:         "gps2mqtt/device/{{.ID}}/attributes",
+				Command:            "gps2mqtt/device/{{.ID}}/command",
+				Result:             "gps2mqtt/device/{{.ID}}/command/result",
+				Availability:       "gps2mqtt/availability",
+				DeviceAvailability: "gps2mqtt/device/{{.ID}}/availability",
+				Events:             "gps2mqtt/device/{{.ID}}/events",
+				Voice:              "gps2mqtt/device/{{.ID}}/voice",
+				Health:             "gps2mqtt/device/{{.ID}}/health",
+			},
+			Payload: "packet",
 		},
 		Status: ConfigStatus{
 			Enabled: false,
 			Listen:  "127.0.0.1:8080",
 		},
+		ShutdownTimeout: 10 * time.Second,
 	}
 
 	var err error
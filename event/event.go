@@ -0,0 +1,70 @@
+// Package event is the alarm vocabulary every protocol's alarms are decoded
+// to, so automations don't depend on which tracker raised them.
+package event
+
+import (
+	"time"
+
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/freman/gps2mqtt/position"
+)
+
+// Alarm is something a tracker raises that someone probably wants to know
+// about.
+type Alarm string
+
+const (
+	AlarmSOS        Alarm = "sos"
+	AlarmLowBattery Alarm = "low_battery"
+	AlarmPowerCut   Alarm = "power_cut"
+	AlarmVibration  Alarm = "vibration"
+	AlarmOverspeed  Alarm = "overspeed"
+	AlarmGeofence   Alarm = "geofence"
+	AlarmRemoval    Alarm = "removal"
+	AlarmFatigue    Alarm = "fatigue"
+	AlarmGNSSFault  Alarm = "gnss_fault"
+	AlarmTheft      Alarm = "theft"
+	AlarmIgnition   Alarm = "ignition" // Ignition when it shouldn't be
+	AlarmMovement   Alarm = "movement" // Moved when it shouldn't be
+	AlarmCollision  Alarm = "collision"
+	AlarmRollover   Alarm = "rollover"
+	AlarmDoor       Alarm = "door" // Door opened when it shouldn't be
+)
+
+// Alarmer is implemented by packets that can carry alarms.
+type Alarmer interface {
+	// Alarms returns the alarms active in this packet.
+	Alarms() []Alarm
+	// SupportedAlarms returns every alarm the protocol can raise.
+	SupportedAlarms() []Alarm
+}
+
+// Event is an alarm raised by a tracker.
+type Event struct {
+	Device   string `json:"device"`
+	Protocol string `json:"protocol"`
+	Alarm    Alarm  `json:"alarm"`
+
+	// Received is when gps2mqtt received the alarm.
+	Received time.Time `json:"received"`
+
+	// Position is where the tracker was, if the alarm came with a location.
+	Position *position.Position `json:"position,omitempty"`
+}
+
+// New builds the event for an alarm raised by msg.
+func New(msg mqtt.Identifier, alarm Alarm) Event {
+	e := Event{
+		Device:   msg.Device(),
+		Protocol: msg.Protocol(),
+		Alarm:    alarm,
+		Received: time.Now(),
+	}
+
+	if msg.Valid() {
+		e.Position = msg.Location()
+		e.Received = e.Position.Received
+	}
+
+	return e
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"time"
+
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// Measurement is something a tracker can measure about its wearer.
+type Measurement string
+
+const (
+	HeartRate   Measurement = "heart_rate"
+	Systolic    Measurement = "systolic"
+	Diastolic   Measurement = "diastolic"
+	Temperature Measurement = "temperature"
+	Oxygen      Measurement = "oxygen"
+)
+
+// Reporter is implemented by packets that can carry health readings, not
+// every tracker speaking a protocol can measure everything so sensors are
+// only announced once a tracker has reported the measurement.
+type Reporter interface {
+	// Readings returns the readings in this packet.
+	Readings() []Reading
+}
+
+// Reading is a single measurement taken by a tracker.
+type Reading struct {
+	Measurement Measurement `json:"measurement"`
+	Value       float64     `json:"value"`
+}
+
+// Report is a reading published to MQTT.
+type Report struct {
+	Device      string      `json:"device"`
+	Protocol    string      `json:"protocol"`
+	Measurement Measurement `json:"measurement"`
+	Value       float64     `json:"value"`
+	Unit        string      `json:"unit"`
+
+	// Received is when gps2mqtt received the reading.
+	Received time.Time `json:"received"`
+}
+
+// New builds the report for a reading taken by msg.
+func New(msg mqtt.Identifier, reading Reading, received time.Time) Report {
+	return Report{
+		Device:      msg.Device(),
+		Protocol:    msg.Protocol(),
+		Measurement: reading.Measurement,
+		Value:       reading.Value,
+		Unit:        reading.Measurement.Sensor().Unit,
+		Received:    received,
+	}
+}
+
+// Sensor describes the Home Assistant sensor for the measurement, reading
+// the value of its report. Every report has a value so the sensor is told
+// apart by the measurement.
+func (m Measurement) Sensor() homeassistant.Sensor {
+	return sensors[m]
+}
+
+var sensors = map[Measurement]homeassistant.Sensor{
+	HeartRate: {
+		Key:        "value",
+		ID:         "heart_rate",
+		Name:       "Heart rate",
+		StateClass: "measurement",
+		Unit:       "bpm",
+		Icon:       "mdi:heart-pulse",
+	},
+	Systolic: {
+		Key:         "value",
+		ID:          "systolic",
+		Name:        "Systolic blood pressure",
+		DeviceClass: "pressure",
+		StateClass:  "measurement",
+		Unit:        "mmHg",
+	},
+	Diastolic: {
+		Key:         "value",
+		ID:          "diastolic",
+		Name:        "Diastolic blood pressure",
+		DeviceClass: "pressure",
+		StateClass:  "measurement",
+		Unit:        "mmHg",
+	},
+	Temperature: {
+		Key:         "value",
+		ID:          "temperature",
+		Name:        "Body temperature",
+		DeviceClass: "temperature",
+		StateClass:  "measurement",
+		Unit:        "°C",
+	},
+	Oxygen: {
+		Key:        "value",
+		ID:         "oxygen",
+		Name:       "Blood oxygen",
+		StateClass: "measurement",
+		Unit:       "%",
+		Icon:       "mdi:water-percent",
+	},
+}
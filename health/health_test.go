@@ -0,0 +1,21 @@
+package health
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensor(t *testing.T) {
+	sc := HeartRate.Sensor().Configuration("Bob", "gps2mqtt_1234567890", "gps2mqtt/bob/health/heart_rate", "value_json", nil, nil)
+
+	b, err := json.Marshal(sc)
+	assert.NoError(t, err)
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &payload))
+	assert.Equal(t, "gps2mqtt_1234567890_heart_rate", payload["unique_id"])
+	assert.Equal(t, "{{ value_json.value }}", payload["value_template"])
+	assert.Equal(t, "Bob Heart rate", payload["name"])
+}
@@ -1,11 +1,34 @@
 package homeassistant
 
+// Availability is one of the topics an entity watches to know if it is
+// available.
+type Availability struct {
+	Topic string `json:"topic"`
+}
+
 type AutoConfiguration struct {
-	StateTopic          string `json:"state_topic"`
-	Name                string `json:"name"`
-	AvailabilityTopic   string `json:"availability_topic"`
-	JSONAttributesTopic string `json:"json_attributes_topic"`
-	Icon                string `json:"icon,omitempty"`
-	SourceType          string `json:"source_type"`
-	UniqueID            string `json:"unique_id"`
+	StateTopic             string         `json:"state_topic"`
+	Name                   string         `json:"name"`
+	Availability           []Availability `json:"availability"`
+	AvailabilityMode       string         `json:"availability_mode,omitempty"`
+	JSONAttributesTopic    string         `json:"json_attributes_topic"`
+	JSONAttributesTemplate string         `json:"json_attributes_template,omitempty"`
+	Icon                   string         `json:"icon,omitempty"`
+	SourceType             string         `json:"source_type"`
+	UniqueID               string         `json:"unique_id"`
+	Device                 *Device        `json:"device,omitempty"`
+}
+
+type SensorConfiguration struct {
+	StateTopic        string         `json:"state_topic"`
+	Name              string         `json:"name"`
+	Availability      []Availability `json:"availability"`
+	AvailabilityMode  string         `json:"availability_mode,omitempty"`
+	ValueTemplate     string         `json:"value_template"`
+	DeviceClass       string         `json:"device_class,omitempty"`
+	StateClass        string         `json:"state_class,omitempty"`
+	UnitOfMeasurement string         `json:"unit_of_measurement,omitempty"`
+	Icon              string         `json:"icon,omitempty"`
+	UniqueID          string         `json:"unique_id"`
+	Device            *Device        `json:"device,omitempty"`
 }
@@ -0,0 +1,52 @@
+package homeassistant
+
+// Device groups all of a tracker's entities together in the Home Assistant
+// device registry.
+type Device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name,omitempty"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+}
+
+// DeviceDescriber is implemented by packets that carry information about the
+// tracker that sent them, fields the packet doesn't know are left empty.
+type DeviceDescriber interface {
+	DescribeDevice() Device
+}
+
+// Merge copies the non empty fields of o over d and adds any identifiers d
+// doesn't already have, returning true if anything changed.
+func (d *Device) Merge(o Device) (changed bool) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&d.Name, o.Name},
+		{&d.Manufacturer, o.Manufacturer},
+		{&d.Model, o.Model},
+		{&d.SWVersion, o.SWVersion},
+		{&d.SerialNumber, o.SerialNumber},
+	} {
+		if field.src != "" && *field.dst != field.src {
+			*field.dst = field.src
+			changed = true
+		}
+	}
+
+identifiers:
+	for _, id := range o.Identifiers {
+		for _, has := range d.Identifiers {
+			if id == has {
+				continue identifiers
+			}
+		}
+
+		d.Identifiers = append(d.Identifiers, id)
+		changed = true
+	}
+
+	return changed
+}
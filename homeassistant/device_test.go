@@ -0,0 +1,28 @@
+package homeassistant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceMerge(t *testing.T) {
+	d := Device{
+		Identifiers:  []string{"gps2mqtt_1234"},
+		Manufacturer: "3G",
+	}
+
+	assert.False(t, d.Merge(Device{Manufacturer: "3G"}))
+	assert.False(t, d.Merge(Device{Identifiers: []string{"gps2mqtt_1234"}}))
+
+	assert.True(t, d.Merge(Device{
+		Identifiers: []string{"iccid_8961"},
+		Model:       "Q50",
+	}))
+
+	assert.Equal(t, Device{
+		Identifiers:  []string{"gps2mqtt_1234", "iccid_8961"},
+		Manufacturer: "3G",
+		Model:        "Q50",
+	}, d)
+}
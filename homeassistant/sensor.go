@@ -0,0 +1,112 @@
+package homeassistant
+
+// Sensor describes a value found in a tracker's attributes that can be
+// exposed to Home Assistant as a sensor entity.
+type Sensor struct {
+	Key         string
+	Name        string
+	DeviceClass string
+	StateClass  string
+	Unit        string
+	Icon        string
+
+	// ID ends the sensor's unique ID instead of Key when Key isn't unique to
+	// the tracker.
+	ID string
+}
+
+// Sensorer is implemented by packets that report values worth exposing as
+// sensors.
+type Sensorer interface {
+	Sensors() []Sensor
+}
+
+var (
+	SensorBattery = Sensor{
+		Key:         "battery_pct",
+		Name:        "Battery",
+		DeviceClass: "battery",
+		StateClass:  "measurement",
+		Unit:        "%",
+	}
+
+	SensorSpeed = Sensor{
+		Key:         "speed_kmh",
+		Name:        "Speed",
+		DeviceClass: "speed",
+		StateClass:  "measurement",
+		Unit:        "km/h",
+	}
+
+	SensorSatellites = Sensor{
+		Key:        "satellites",
+		Name:       "Satellites",
+		StateClass: "measurement",
+		Icon:       "mdi:satellite-variant",
+	}
+
+	SensorSignal = Sensor{
+		Key:        "signal_pct",
+		Name:       "Signal strength",
+		StateClass: "measurement",
+		Unit:       "%",
+		Icon:       "mdi:signal",
+	}
+
+	SensorPower = Sensor{
+		Key:         "power_v",
+		Name:        "External power",
+		DeviceClass: "voltage",
+		StateClass:  "measurement",
+		Unit:        "V",
+	}
+
+	SensorAltitude = Sensor{
+		Key:         "altitude_m",
+		Name:        "Altitude",
+		DeviceClass: "distance",
+		StateClass:  "measurement",
+		Unit:        "m",
+	}
+
+	// SensorSteps and SensorRolling are counters the tracker resets, usually
+	// daily.
+	SensorSteps = Sensor{
+		Key:        "steps",
+		Name:       "Steps",
+		StateClass: "total_increasing",
+		Icon:       "mdi:walk",
+	}
+
+	SensorRolling = Sensor{
+		Key:        "rolling",
+		Name:       "Rolling",
+		StateClass: "total_increasing",
+		Icon:       "mdi:rotate-3d-variant",
+	}
+)
+
+// Configuration builds the discovery payload for a sensor reading its value
+// from the JSON published to stateTopic, valuePath is where the attributes
+// are found in that JSON (eg value_json). The sensor is only available when
+// every availability topic says so.
+func (s Sensor) Configuration(name, uniqueID, stateTopic, valuePath string, availability []Availability, device *Device) SensorConfiguration {
+	id := s.ID
+	if id == "" {
+		id = s.Key
+	}
+
+	return SensorConfiguration{
+		StateTopic:        stateTopic,
+		Name:              name + " " + s.Name,
+		Availability:      availability,
+		AvailabilityMode:  "all",
+		ValueTemplate:     "{{ " + valuePath + "." + s.Key + " }}",
+		DeviceClass:       s.DeviceClass,
+		StateClass:        s.StateClass,
+		UnitOfMeasurement: s.Unit,
+		Icon:              s.Icon,
+		UniqueID:          uniqueID + "_" + id,
+		Device:            device,
+	}
+}
@@ -0,0 +1,27 @@
+package homeassistant
+
+// TriggerConfiguration is the discovery payload for a device trigger, used
+// to let automations fire on tracker alarms.
+type TriggerConfiguration struct {
+	AutomationType string  `json:"automation_type"`
+	Topic          string  `json:"topic"`
+	Type           string  `json:"type"`
+	Subtype        string  `json:"subtype"`
+	Payload        string  `json:"payload"`
+	ValueTemplate  string  `json:"value_template,omitempty"`
+	Device         *Device `json:"device"`
+}
+
+// AlarmTrigger builds the device trigger for an alarm published to topic,
+// valueTemplate extracts the alarm name from what is published.
+func AlarmTrigger(alarm, topic, valueTemplate string, device *Device) TriggerConfiguration {
+	return TriggerConfiguration{
+		AutomationType: "trigger",
+		Topic:          topic,
+		Type:           "alarm",
+		Subtype:        alarm,
+		Payload:        alarm,
+		ValueTemplate:  valueTemplate,
+		Device:         device,
+	}
+}
@@ -1,7 +1,12 @@
 package mqtt
 
+import "github.com/freman/gps2mqtt/position"
+
 type Identifier interface {
 	MQTTID() string
 	Device() string
+	Protocol() string
 	Valid() bool
+	// Location is what gets published for packets that are Valid.
+	Location() *position.Position
 }
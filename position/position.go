@@ -0,0 +1,113 @@
+// Package position is the location report every protocol is normalised to,
+// so what is published looks the same whichever tracker sent it.
+package position
+
+import "time"
+
+// Fix describes how the location was worked out.
+type Fix string
+
+const (
+	// FixNone means the tracker had no fix, the location is whatever it
+	// last knew and may be zero.
+	FixNone Fix = "none"
+	// FixGPS is a satellite fix.
+	FixGPS Fix = "gps"
+)
+
+// Position is a tracker's location. Units are part of the JSON names and
+// anything the tracker didn't report is left out rather than zeroed.
+type Position struct {
+	Device   string `json:"device"`
+	Protocol string `json:"protocol"`
+
+	// Timestamp is when the tracker took the fix, Received is when
+	// gps2mqtt received it.
+	Timestamp time.Time `json:"timestamp"`
+	Received  time.Time `json:"received"`
+
+	Fix Fix `json:"fix"`
+
+	// Latitude and Longitude are WGS84 decimal degrees, negative being
+	// south and west.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	Altitude   *float64 `json:"altitude_m,omitempty"`
+	Speed      *float64 `json:"speed_kmh,omitempty"`
+	Heading    *float64 `json:"heading_deg,omitempty"`
+	Satellites *int     `json:"satellites,omitempty"`
+
+	// Battery and Signal are percentages, signal being the mobile network.
+	Battery *float64 `json:"battery_pct,omitempty"`
+	Signal  *float64 `json:"signal_pct,omitempty"`
+
+	// Power is the external supply in volts.
+	Power *float64 `json:"power_v,omitempty"`
+
+	Ignition    *bool `json:"ignition,omitempty"`
+	Charging    *bool `json:"charging,omitempty"`
+	Armed       *bool `json:"armed,omitempty"`
+	Tracking    *bool `json:"gps_tracking,omitempty"`
+	Immobilized *bool `json:"immobilized,omitempty"`
+	Door        *bool `json:"door,omitempty"`
+
+	// Steps and Rolling are the pedometer and how many times the tracker
+	// has been turned over.
+	Steps   *int `json:"steps,omitempty"`
+	Rolling *int `json:"rolling,omitempty"`
+
+	// Cells and WiFi are what the tracker could see, for working out where
+	// it is without a fix.
+	Cells []Cell `json:"cells,omitempty"`
+	WiFi  []WiFi `json:"wifi,omitempty"`
+
+	// IMSI and ICCID identify the tracker's SIM card.
+	IMSI  string `json:"imsi,omitempty"`
+	ICCID string `json:"iccid,omitempty"`
+}
+
+// Cell is a mobile network cell, Signal is as the tracker reported it.
+type Cell struct {
+	MCC    uint16 `json:"mcc"`
+	MNC    uint16 `json:"mnc"`
+	LAC    uint32 `json:"lac"`
+	CellID uint32 `json:"cell_id"`
+	Signal int    `json:"signal,omitempty"`
+}
+
+// WiFi is an access point, Signal is in dBm.
+type WiFi struct {
+	MAC    string `json:"mac"`
+	Signal int    `json:"signal_dbm"`
+}
+
+// Updater is implemented by packets without a location that still update
+// what is known about the tracker, such as its battery.
+type Updater interface {
+	Update(pos *Position)
+}
+
+// FixFrom returns FixGPS if valid, otherwise FixNone.
+func FixFrom(valid bool) Fix {
+	if valid {
+		return FixGPS
+	}
+
+	return FixNone
+}
+
+// Float returns a pointer to v, for the optional fields.
+func Float(v float64) *float64 {
+	return &v
+}
+
+// Int returns a pointer to v, for the optional fields.
+func Int(v int) *int {
+	return &v
+}
+
+// Bool returns a pointer to v, for the optional fields.
+func Bool(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+var inflight = struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	conns map[net.Conn]struct{}
+}{
+	conns: map[net.Conn]struct{}{},
+}
+
+// Accept hands each connection accepted from nl to serve, in its own
+// goroutine, until ctx is cancelled. Connections are tracked so they can be
+// drained on shutdown.
+func Accept(ctx context.Context, nl net.Listener, serve func(net.Conn)) error {
+	go func() {
+		<-ctx.Done()
+		nl.Close()
+	}()
+
+	for {
+		c, err := nl.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		done := track(c)
+
+		go func() {
+			defer done()
+			serve(c)
+		}()
+	}
+}
+
+func track(c net.Conn) func() {
+	inflight.mu.Lock()
+	defer inflight.mu.Unlock()
+
+	inflight.wg.Add(1)
+	inflight.conns[c] = struct{}{}
+
+	return func() {
+		inflight.mu.Lock()
+		defer inflight.mu.Unlock()
+
+		delete(inflight.conns, c)
+		inflight.wg.Done()
+	}
+}
+
+// Drain gives in-flight connections until timeout to finish the packet they
+// are reading, then closes any that remain. It returns once every connection
+// handed out by Accept has been served, so should only be called after every
+// Accept has returned.
+func Drain(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		inflight.wg.Wait()
+		close(done)
+	}()
+
+	deadline := time.Now().Add(timeout)
+
+	inflight.mu.Lock()
+	for c := range inflight.conns {
+		c.SetReadDeadline(deadline)
+	}
+	inflight.mu.Unlock()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	inflight.mu.Lock()
+	for c := range inflight.conns {
+		c.Close()
+	}
+	inflight.mu.Unlock()
+
+	<-done
+}
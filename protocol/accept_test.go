@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptDrain(t *testing.T) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	accepted := make(chan error, 1)
+
+	go func() {
+		accepted <- Accept(ctx, nl, func(c net.Conn) {
+			// Idle tracker, never sends anything.
+			_, err := c.Read(make([]byte, 1))
+			served <- err
+		})
+	}()
+
+	client, err := net.Dial("tcp", nl.Addr().String())
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// Make sure the connection has been accepted before cancelling.
+	require.Eventually(t, func() bool {
+		inflight.mu.Lock()
+		defer inflight.mu.Unlock()
+
+		return len(inflight.conns) == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-accepted)
+
+	start := time.Now()
+	Drain(50 * time.Millisecond)
+
+	assert.Error(t, <-served)
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, err = net.Dial("tcp", nl.Addr().String())
+	assert.Error(t, err)
+}
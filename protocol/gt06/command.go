@@ -0,0 +1,87 @@
+package gt06
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+// maxSent is the number of commands remembered while waiting for a reply.
+const maxSent = 16
+
+type encoder struct {
+	mu       sync.Mutex
+	sequence uint16
+	flag     uint32
+
+	// sent is the name of each command waiting on a reply by its server
+	// flag, which the device sends back with the reply.
+	sent []sentCommand
+}
+
+type sentCommand struct {
+	flag uint32
+	name string
+}
+
+func newEncoder() *encoder {
+	return &encoder{}
+}
+
+// Encode wraps the command text in an online command (0x80) packet, devices
+// ignore commands that don't end with a #.
+func (e *encoder) Encode(cmd command.Command) ([]byte, error) {
+	content := cmd.Text()
+	if !strings.HasSuffix(content, "#") {
+		content += "#"
+	}
+
+	if len(content) > 0xff-4 {
+		return nil, fmt.Errorf("command too long (%d bytes)", len(content))
+	}
+
+	flag, sequence := e.next(cmd.Name())
+
+	body := make([]byte, 5, 5+len(content))
+	body[0] = byte(4 + len(content))
+	binary.BigEndian.PutUint32(body[1:5], flag)
+	body = append(body, content...)
+
+	return frame(protoCommand, body, sequence, false), nil
+}
+
+// next returns the server flag and sequence for a command, remembering the
+// flag so the reply can be matched to it.
+func (e *encoder) next(name string) (flag uint32, sequence uint16) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.flag++
+	e.sequence++
+
+	e.sent = append(e.sent, sentCommand{flag: e.flag, name: name})
+	if len(e.sent) > maxSent {
+		e.sent = e.sent[1:]
+	}
+
+	return e.flag, e.sequence
+}
+
+// command returns the name of the command sent with the server flag, or an
+// empty string if it isn't known.
+func (e *encoder) command(flag uint32) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, sent := range e.sent {
+		if sent.flag == flag {
+			e.sent = append(e.sent[:i], e.sent[i+1:]...)
+			return sent.name
+		}
+	}
+
+	return ""
+}
@@ -2,12 +2,15 @@ package gt06
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net"
 	"syscall"
 	"time"
 
+	"github.com/freman/gps2mqtt/command"
 	"github.com/freman/gps2mqtt/mqtt"
 	"github.com/freman/gps2mqtt/protocol"
 	"github.com/freman/gps2mqtt/status"
@@ -25,53 +28,70 @@ type Listener struct {
 	ReadTimeout  time.Duration
 }
 
-func (l *Listener) Run(chMsg chan mqtt.Identifier) error {
+func (l *Listener) Run(ctx context.Context, chMsg chan mqtt.Identifier) error {
 	l.log.Info().Str("cfg", l.Listen).Msg("Starting listener.")
 
 	nl, err := net.Listen("tcp", l.Listen)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	for {
-		c, err := nl.Accept()
+	return protocol.Accept(ctx, nl, func(c net.Conn) {
+		l.Serve(ctx, c, chMsg)
+	})
+}
 
-		if err != nil {
-			l.log.Fatal().Err(err).Msg("Unable to start listener.")
-		}
+func (l *Listener) Address() string {
+	return l.Listen
+}
 
-		logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
-		logger.Info().Msg("Client connected.")
-		l.connections.Connected(c)
+func (l *Listener) Detect(peek []byte) bool {
+	return bytes.HasPrefix(peek, startMessage) || bytes.HasPrefix(peek, startExtended)
+}
 
-		go l.HandleConnection(c, chMsg, logger)
-	}
+func (l *Listener) Serve(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier) {
+	logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
+	logger.Info().Msg("Client connected.")
+	l.connections.Connected(c)
+
+	l.HandleConnection(ctx, c, chMsg, logger)
 }
 
-func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
+func (l *Listener) HandleConnection(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
 	defer func() {
 		log.Info().Msg("Client disconnected.")
 
 		l.connections.Disconnected(c)
+		command.Unregister(c)
 
 		if err := c.Close(); err != nil {
 			log.Error().Err(err).Msg("Error while closing client connection.")
 		}
 	}()
 
+	enc := newEncoder()
+
 	p := Parser{
-		reader: bufio.NewReader(c),
+		reader:   bufio.NewReader(c),
+		commands: enc,
 	}
 
+	registered := false
+
 	for {
 		if err := c.SetReadDeadline(time.Now().Add(l.ReadTimeout)); err != nil {
 			log.Error().Err(err).Msg("Failed to set a read deadline.")
 			return
 		}
 
+		// Checked after setting the deadline so a drain can't be overridden.
+		if ctx.Err() != nil {
+			return
+		}
+
 		packet, err := p.ReadPacket()
 		if err != nil {
-			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) {
+			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) || ctx.Err() != nil {
 				return
 			}
 
@@ -90,6 +110,8 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
+		packet.received = time.Now()
+
 		l.connections.Packet(c, packet)
 
 		if !l.CheckWhitelist(packet) {
@@ -99,20 +121,15 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
-		if packet.WantsResponse() {
-			if err = c.SetWriteDeadline(time.Now().Add(l.WriteTimeout)); err != nil {
-				log.Error().Err(err).Msg("Failed to set a write deadline.")
-				return
-			}
+		if !registered {
+			command.Register(packet, c, enc, l.WriteTimeout)
+			registered = true
+		}
 
-			if err := packet.Respond(c); err != nil {
+		if packet.WantsResponse() {
+			if err := command.Write(c, l.WriteTimeout, packet.Respond); err != nil {
 				log.Error().Err(err).Msg("Failed to finish handshake.")
 			}
-
-			if err = c.SetWriteDeadline(time.Time{}); err != nil {
-				log.Error().Err(err).Msg("Failed to clear a write deadline.")
-				return
-			}
 		}
 
 		chMsg <- packet
@@ -0,0 +1,124 @@
+package gt06
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/freman/gps2mqtt/position"
+)
+
+// neighbours is how many neighbouring cells follow the serving cell in LBS
+// multi-cell and WiFi packets.
+const neighbours = 6
+
+// readCell reads a cell, the mobile country code, mobile network code,
+// location area code and cell id, followed by the signal if withSignal.
+func readCell(reader *bytes.Reader, withSignal bool) (position.Cell, error) {
+	var cell position.Cell
+
+	mcc, mnc, err := readNetwork(reader)
+	if err != nil {
+		return cell, err
+	}
+
+	cell.MCC = mcc
+	cell.MNC = mnc
+
+	return cell, readArea(reader, &cell, withSignal)
+}
+
+// readNetwork reads the mobile country and network codes, when the top bit of
+// the country code is set the network code is two bytes.
+func readNetwork(reader *bytes.Reader) (mcc, mnc uint16, err error) {
+	if err := binary.Read(reader, binary.BigEndian, &mcc); err != nil {
+		return 0, 0, err
+	}
+
+	if mcc&0x8000 == 0x8000 {
+		mcc &= 0x7fff
+		err = binary.Read(reader, binary.BigEndian, &mnc)
+	} else {
+		var b byte
+		b, err = reader.ReadByte()
+		mnc = uint16(b)
+	}
+
+	return mcc, mnc, err
+}
+
+// readArea reads the location area code, cell id and, if withSignal, the
+// signal of a cell.
+func readArea(reader *bytes.Reader, cell *position.Cell, withSignal bool) error {
+	var area [5]byte
+	if _, err := io.ReadFull(reader, area[:]); err != nil {
+		return err
+	}
+
+	cell.LAC = uint32(binary.BigEndian.Uint16(area[:2]))
+	cell.CellID = uint32(area[2])<<16 | uint32(area[3])<<8 | uint32(area[4])
+
+	if !withSignal {
+		return nil
+	}
+
+	signal, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	cell.Signal = int(signal)
+
+	return nil
+}
+
+// readCells reads the serving cell and its neighbours, leaving out the empty
+// neighbour slots.
+func readCells(reader *bytes.Reader) ([]position.Cell, error) {
+	serving, err := readCell(reader, true)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := []position.Cell{serving}
+
+	for i := 0; i < neighbours; i++ {
+		cell := position.Cell{MCC: serving.MCC, MNC: serving.MNC}
+		if err := readArea(reader, &cell, true); err != nil {
+			return nil, err
+		}
+
+		if cell.LAC != 0 || cell.CellID != 0 {
+			cells = append(cells, cell)
+		}
+	}
+
+	return cells, nil
+}
+
+// readWiFi reads the count of access points followed by each one's mac and
+// signal strength.
+func readWiFi(reader *bytes.Reader) ([]position.WiFi, error) {
+	count, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	aps := make([]position.WiFi, 0, count)
+
+	for i := 0; i < int(count); i++ {
+		var ap [7]byte
+		if _, err := io.ReadFull(reader, ap[:]); err != nil {
+			return nil, err
+		}
+
+		aps = append(aps, position.WiFi{
+			MAC: fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", ap[0], ap[1], ap[2], ap[3], ap[4], ap[5]),
+			// Signal strength is sent as a positive number of -dBm.
+			Signal: -int(ap[6]),
+		})
+	}
+
+	return aps, nil
+}
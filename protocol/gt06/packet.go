@@ -9,6 +9,10 @@ import (
 	"time"
 
 	"github.com/freman/gps2mqtt/checksum"
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/position"
 )
 
 type Packet struct {
@@ -20,9 +24,30 @@ type Packet struct {
 	Speed     float64   `json:"speed"`
 	Position  bool      `json:"position"`
 	Satelites int       `json:"satelites"`
+	Status    *Status   `json:"status,omitempty"`
+
+	ACC             *bool           `json:"acc,omitempty"`
+	Cells           []position.Cell `json:"cells,omitempty"`
+	WiFi            []position.WiFi `json:"wifi,omitempty"`
+	ExternalVoltage *float64        `json:"external_voltage,omitempty"`
+	IMSI            string          `json:"imsi,omitempty"`
+	ICCID           string          `json:"iccid,omitempty"`
+	Response        string          `json:"response,omitempty"`
+	TypeID          string          `json:"type_id,omitempty"`
+	Timezone        string          `json:"timezone,omitempty"`
 
 	protocol byte
 	sequence uint16
+	received time.Time
+
+	// serverFlag is sent back with a reply, replyTo is the name of the
+	// command it was sent with if known.
+	serverFlag uint32
+	replyTo    string
+
+	// extended is true if the packet came with the two byte length, the
+	// response has to match.
+	extended bool
 }
 
 func (p *Packet) MQTTID() string {
@@ -33,33 +58,123 @@ func (p *Packet) Device() string {
 	return p.DeviceID.String()
 }
 
-func (p *Packet) Respond(writer io.Writer) (err error) {
-	var buf bytes.Buffer
-	buf.Write(startMessage)
-	buf.WriteByte(0x05)
-	buf.WriteByte(p.protocol)
+func (p *Packet) Protocol() string {
+	return Name
+}
 
-	if err := binary.Write(&buf, binary.BigEndian, p.sequence); err != nil {
-		return err
+func (p *Packet) Respond(writer io.Writer) (err error) {
+	var body []byte
+
+	// Time calibration is answered with the time.
+	if p.protocol == protoTimeCalibration {
+		now := time.Now().UTC()
+		body = []byte{
+			byte(now.Year() % 100),
+			byte(now.Month()),
+			byte(now.Day()),
+			byte(now.Hour()),
+			byte(now.Minute()),
+			byte(now.Second()),
+		}
 	}
 
-	buf.Write([]byte{0, 0})
-	buf.Write(stopMessage)
-
-	b := buf.Bytes()
-	binary.BigEndian.PutUint16(b[6:8], checksum.CRC16_ITU(b[1:6]))
-
-	_, err = writer.Write(b)
+	_, err = writer.Write(frame(p.protocol, body, p.sequence, p.extended))
 
 	return err
 }
 
+// WantsResponse is false for the packets the device doesn't expect an answer
+// to.
 func (p *Packet) WantsResponse() bool {
+	switch p.protocol {
+	case protoGPSLBS, protoLBSMulti, protoInformation, protoString, protoStringInfo:
+		return false
+	}
+
 	return true
 }
 
 func (p *Packet) Valid() bool {
-	return p.protocol == protoLocation
+	switch p.protocol {
+	case protoLocation, protoAlarm, protoGPSLBS, protoAlarmLBS:
+		return true
+	}
+
+	return false
+}
+
+// Reply returns the device's reply to a command, replies to commands we don't
+// know the server flag of are matched with the oldest command.
+func (p *Packet) Reply() *command.Result {
+	if p.protocol != protoString && p.protocol != protoStringInfo {
+		return nil
+	}
+
+	return &command.Result{
+		Command:   p.replyTo,
+		Status:    command.StatusReply,
+		Response:  p.Response,
+		Timestamp: p.received,
+	}
+}
+
+var alarms = map[byte]event.Alarm{
+	0x01: event.AlarmSOS,
+	0x02: event.AlarmPowerCut,
+	0x03: event.AlarmVibration,
+	0x04: event.AlarmGeofence, // Entered
+	0x05: event.AlarmGeofence, // Left
+	0x06: event.AlarmOverspeed,
+	0x09: event.AlarmVibration,
+	0x0E: event.AlarmLowBattery,
+	0x0F: event.AlarmLowBattery,
+	0x13: event.AlarmRemoval,
+}
+
+// Alarms are those in the last status, which stay active until a status
+// without them.
+func (p *Packet) Alarms() []event.Alarm {
+	if p.Status == nil {
+		return nil
+	}
+
+	return p.Status.alarms()
+}
+
+func (p *Packet) SupportedAlarms() []event.Alarm {
+	return []event.Alarm{
+		event.AlarmSOS,
+		event.AlarmPowerCut,
+		event.AlarmVibration,
+		event.AlarmGeofence,
+		event.AlarmOverspeed,
+		event.AlarmLowBattery,
+		event.AlarmRemoval,
+	}
+}
+
+// frame wraps a message body with the start bits, length, protocol number,
+// sequence, crc and stop bits. Extended frames have a two byte length.
+func frame(protocol byte, body []byte, sequence uint16, extended bool) []byte {
+	var buf bytes.Buffer
+
+	if extended {
+		buf.Write(startExtended)
+		binary.Write(&buf, binary.BigEndian, uint16(1+len(body)+4))
+	} else {
+		buf.Write(startMessage)
+		buf.WriteByte(byte(1 + len(body) + 4))
+	}
+
+	buf.WriteByte(protocol)
+	buf.Write(body)
+	binary.Write(&buf, binary.BigEndian, sequence)
+
+	crc := checksum.CRC16_ITU(buf.Bytes()[len(startMessage):])
+	binary.Write(&buf, binary.BigEndian, crc)
+	buf.Write(stopMessage)
+
+	return buf.Bytes()
 }
 
 type hexString []byte
@@ -71,3 +186,70 @@ func (h *hexString) String() string {
 func (h *hexString) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + h.String() + `"`), nil
 }
+
+func (p *Packet) Location() *position.Position {
+	pos := &position.Position{
+		Device:     p.Device(),
+		Protocol:   Name,
+		Timestamp:  p.Timestamp,
+		Received:   p.received,
+		Fix:        position.FixFrom(p.Position),
+		Latitude:   p.Latitude,
+		Longitude:  p.Longitude,
+		Speed:      position.Float(p.Speed),
+		Heading:    position.Float(p.Heading),
+		Satellites: position.Int(p.Satelites),
+	}
+
+	p.Update(pos)
+
+	return pos
+}
+
+// Update adds the status, cells and power to a position, status, heartbeat,
+// cell and information packets don't have a location of their own.
+func (p *Packet) Update(pos *position.Position) {
+	if p.Status != nil {
+		p.Status.apply(pos)
+	}
+
+	if p.ACC != nil {
+		pos.Ignition = p.ACC
+	}
+
+	if p.Cells != nil || p.WiFi != nil {
+		pos.Cells = p.Cells
+		pos.WiFi = p.WiFi
+	}
+
+	if p.ExternalVoltage != nil {
+		pos.Power = p.ExternalVoltage
+	}
+
+	if p.ICCID != "" {
+		pos.IMSI = p.IMSI
+		pos.ICCID = p.ICCID
+	}
+
+	pos.Received = p.received
+}
+
+func (p *Packet) Sensors() []homeassistant.Sensor {
+	return []homeassistant.Sensor{
+		homeassistant.SensorBattery,
+		homeassistant.SensorSpeed,
+		homeassistant.SensorSatellites,
+		homeassistant.SensorSignal,
+		homeassistant.SensorPower,
+	}
+}
+
+func (p *Packet) DescribeDevice() homeassistant.Device {
+	var d homeassistant.Device
+
+	if p.ICCID != "" {
+		d.Identifiers = []string{"iccid_" + p.ICCID}
+	}
+
+	return d
+}
@@ -4,27 +4,55 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/freman/gps2mqtt/checksum"
+	"github.com/freman/gps2mqtt/position"
 	"github.com/rs/zerolog"
 )
 
 const (
-	protoLogin    byte = 0x01
-	protoLocation byte = 0x12
-	protoStatus   byte = 0x13
-	protoString   byte = 0x15
-	protoAlarm    byte = 0x16
-	protoGPSQuery byte = 0x1A
-	protoCommand  byte = 0x80
+	protoLogin           byte = 0x01
+	protoLocation        byte = 0x12
+	protoStatus          byte = 0x13
+	protoString          byte = 0x15
+	protoAlarm           byte = 0x16
+	protoGPSQuery        byte = 0x1A
+	protoGPSLBS          byte = 0x22
+	protoStringInfo      byte = 0x21
+	protoHeartbeat       byte = 0x23
+	protoAlarmLBS        byte = 0x26
+	protoLBSMulti        byte = 0x28
+	protoWiFi            byte = 0x2C
+	protoCommand         byte = 0x80
+	protoTimeCalibration byte = 0x8A
+	protoInformation     byte = 0x94
+)
+
+// String information (0x21) content encodings.
+const (
+	encodingASCII byte = 0x01
+	encodingUTF16 byte = 0x02
+)
+
+// Information transmission (0x94) sub protocols.
+const (
+	infoExternalVoltage byte = 0x00
+	infoICCID           byte = 0x0A
 )
 
 var (
 	startMessage = []byte{0x78, 0x78}
-	stopMessage  = []byte{0x0D, 0x0A}
+	// startExtended is used by newer devices for packets too long for a
+	// single byte length.
+	startExtended = []byte{0x79, 0x79}
+	stopMessage   = []byte{0x0D, 0x0A}
 )
 
 type Parser struct {
@@ -32,19 +60,31 @@ type Parser struct {
 	log    zerolog.Logger
 
 	id hexString
+
+	// status is the last status the device sent, it's added to every
+	// packet so locations carry the battery.
+	status *Status
+
+	// location is the timezone the device sends times in, from the login.
+	location *time.Location
+
+	// imsi and iccid are from the last SIM information packet, they're
+	// added to every packet so locations carry them.
+	imsi  string
+	iccid string
+
+	// commands is the connection's encoder, used to match replies with the
+	// commands they answer.
+	commands *encoder
 }
 
 func (p *Parser) read(d []byte) error {
-	sz, err := p.reader.Read(d)
-	if err != nil {
-		return err
-	}
-
-	if len(d) != sz {
+	_, err := io.ReadFull(p.reader, d)
+	if err == io.ErrUnexpectedEOF {
 		return errors.New("unexpected number of bytes read")
 	}
 
-	return nil
+	return err
 }
 
 func (p *Parser) ReadPacket() (*Packet, error) {
@@ -55,20 +95,36 @@ func (p *Parser) ReadPacket() (*Packet, error) {
 		return nil, err
 	}
 
-	if !bytes.Equal(startMessage, start) {
+	extended := bytes.Equal(startExtended, start)
+	if !extended && !bytes.Equal(startMessage, start) {
 		return nil, errors.New("unexpected start bits")
 	}
 
-	length, err := p.reader.ReadByte()
-	if err != nil {
-		return nil, err
+	lengthSize := 1
+	if extended {
+		lengthSize = 2
 	}
 
 	// Prepend length to the message now because it's needed for CRC and I'm lazy
-	msg := make([]byte, length+1)
-	msg[0] = length
+	header := make([]byte, lengthSize)
+	if err := p.read(header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[0])
+	if extended {
+		length = int(binary.BigEndian.Uint16(header))
+	}
+
+	// Protocol number, sequence and crc.
+	if length < 5 {
+		return nil, errors.New("packet too short")
+	}
+
+	msg := make([]byte, lengthSize+length)
+	copy(msg, header)
 
-	if err := p.read(msg[1:]); err != nil {
+	if err := p.read(msg[lengthSize:]); err != nil {
 		return nil, err
 	}
 
@@ -85,29 +141,48 @@ func (p *Parser) ReadPacket() (*Packet, error) {
 	}
 
 	// Strip off the length now cos it causes headaches going forth.
-	msg = msg[1:]
+	msg = msg[lengthSize:]
 
 	return p.parsePacket(&Packet{
 		DeviceID: p.id,
 		protocol: msg[0],
 		sequence: binary.BigEndian.Uint16(msg[length-4 : length-2]),
+		extended: extended,
+		IMSI:     p.imsi,
+		ICCID:    p.iccid,
 	}, msg[1:length-4])
 }
 
 func (p *Parser) parsePacket(packet *Packet, msg []byte) (*Packet, error) {
 	switch packet.protocol {
 	case protoLogin:
-		p.id = msg
-		packet.DeviceID = msg
-		return packet, nil
-	case protoStatus:
-		// TODO: care about status?
-		return packet, nil
+		return p.readLogin(packet, msg)
+	case protoStatus, protoHeartbeat:
+		return p.readStatus(packet, bytes.NewReader(msg), packet.protocol == protoHeartbeat)
 	case protoLocation:
 		return p.readLocation(packet, bytes.NewReader(msg))
-	case protoAlarm:
-		// TODO: care about alarm?
-		return p.readLocation(packet, bytes.NewReader(msg))
+	case protoGPSLBS:
+		r := bytes.NewReader(msg)
+		if _, err := p.readLocation(packet, r); err != nil {
+			return nil, err
+		}
+
+		return p.readGPSLBS(packet, r)
+	case protoAlarm, protoAlarmLBS:
+		r := bytes.NewReader(msg)
+		if _, err := p.readLocation(packet, r); err != nil {
+			return nil, err
+		}
+
+		return p.readAlarm(packet, r)
+	case protoLBSMulti, protoWiFi:
+		return p.readLBSMulti(packet, bytes.NewReader(msg), packet.protocol == protoWiFi)
+	case protoString, protoStringInfo:
+		return p.readReply(packet, msg, packet.protocol == protoStringInfo)
+	case protoTimeCalibration:
+		return packet, nil
+	case protoInformation:
+		return p.readInformation(packet, msg)
 	}
 
 	return nil, errors.New("bad packet")
@@ -125,8 +200,226 @@ func (p *Parser) readLocation(packet *Packet, reader io.Reader) (*Packet, error)
 	packet.Longitude = data.GetLongitude()
 	packet.Position = data.PositionValid()
 	packet.Speed = float64(data.Speed)
-	packet.Timestamp = data.GetTimestamp()
+	packet.Timestamp = data.GetTimestamp(p.location)
 	packet.Satelites = int(data.GetSatelites())
+	packet.Status = p.status
+
+	return packet, nil
+}
+
+// readStatus reads terminal information, keeping anything this kind of
+// packet doesn't carry from the last one.
+func (p *Parser) readStatus(packet *Packet, reader *bytes.Reader, heartbeat bool) (*Packet, error) {
+	status, err := readStatus(reader, heartbeat)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.status != nil {
+		if status.VoltageLevel == nil {
+			status.VoltageLevel = p.status.VoltageLevel
+		}
+
+		if status.ExternalVoltage == nil {
+			status.ExternalVoltage = p.status.ExternalVoltage
+		}
+	}
+
+	p.status = status
+	packet.Status = status
+
+	return packet, nil
+}
+
+// readAlarm reads what follows the location in an alarm packet, the cell
+// tower and status information.
+func (p *Parser) readAlarm(packet *Packet, reader *bytes.Reader) (*Packet, error) {
+	// The cell tower length includes itself.
+	lbsLength, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if lbsLength > 0 {
+		if _, err := reader.Seek(int64(lbsLength)-1, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.readStatus(packet, reader, false)
+}
+
+// readLogin reads the terminal id, GT06N devices follow it with their type
+// identification and the timezone they send times in.
+func (p *Parser) readLogin(packet *Packet, msg []byte) (*Packet, error) {
+	if len(msg) < 8 {
+		return nil, errors.New("login too short")
+	}
+
+	p.id = msg[:8]
+	packet.DeviceID = p.id
+
+	if len(msg) < 12 {
+		return packet, nil
+	}
+
+	packet.TypeID = fmt.Sprintf("%04x", msg[8:10])
+
+	// The offset is in the top 12 bits as HHMM, bit 3 is set for west of
+	// GMT.
+	zone := binary.BigEndian.Uint16(msg[10:12])
+	hhmm := int(zone >> 4)
+	offset := (hhmm/100)*3600 + (hhmm%100)*60
+	minutes := offset / 60
+
+	sign := "+"
+	if zone&0x08 == 0x08 {
+		sign = "-"
+		offset = -offset
+	}
+
+	name := fmt.Sprintf("UTC%s%02d:%02d", sign, minutes/60, minutes%60)
+
+	p.location = time.FixedZone(name, offset)
+	packet.Timezone = name
+
+	return packet, nil
+}
+
+// readGPSLBS reads what follows the location in a GPS and LBS packet, the
+// serving cell and the ACC state. Older devices stop after the cell.
+func (p *Parser) readGPSLBS(packet *Packet, reader *bytes.Reader) (*Packet, error) {
+	cell, err := readCell(reader, false)
+	if err != nil {
+		return nil, err
+	}
+
+	packet.Cells = []position.Cell{cell}
+
+	acc, err := reader.ReadByte()
+	if err == io.EOF {
+		return packet, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	packet.ACC = position.Bool(acc != 0)
+
+	return packet, nil
+}
+
+// readLBSMulti reads the serving and neighbouring cells, and for WiFi packets
+// the access points that follow them.
+func (p *Parser) readLBSMulti(packet *Packet, reader *bytes.Reader, wifi bool) (*Packet, error) {
+	var timestamp [6]byte
+	if _, err := io.ReadFull(reader, timestamp[:]); err != nil {
+		return nil, err
+	}
+
+	packet.Timestamp = packetData{
+		Year:   timestamp[0],
+		Month:  timestamp[1],
+		Day:    timestamp[2],
+		Hour:   timestamp[3],
+		Minute: timestamp[4],
+		Second: timestamp[5],
+	}.GetTimestamp(p.location)
+
+	cells, err := readCells(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	packet.Cells = cells
+	packet.Status = p.status
+
+	if !wifi {
+		return packet, nil
+	}
+
+	// Timing advance
+	if _, err := reader.ReadByte(); err != nil {
+		return nil, err
+	}
+
+	if packet.WiFi, err = readWiFi(reader); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// readReply reads the server flag and text of the device's reply to a
+// command. String information (0x21) replies say how the text is encoded
+// where 0x15 replies have a length.
+func (p *Parser) readReply(packet *Packet, msg []byte, info bool) (*Packet, error) {
+	if len(msg) < 5 {
+		return nil, errors.New("reply too short")
+	}
+
+	var content []byte
+
+	if info {
+		packet.serverFlag = binary.BigEndian.Uint32(msg)
+		content = msg[5:]
+
+		if msg[4] == encodingUTF16 {
+			content = decodeUTF16(content)
+		}
+	} else {
+		// The length covers the server flag and content, anything after
+		// it is the language.
+		end := 1 + int(msg[0])
+		if end > len(msg) || end < 5 {
+			end = len(msg)
+		}
+
+		packet.serverFlag = binary.BigEndian.Uint32(msg[1:5])
+		content = msg[5:end]
+	}
+
+	packet.Response = string(bytes.Trim(content, "\x00\r\n "))
+
+	if p.commands != nil {
+		packet.replyTo = p.commands.command(packet.serverFlag)
+	}
+
+	return packet, nil
+}
+
+// readInformation reads an information transmission packet, only the
+// external voltage and the SIM details are understood.
+func (p *Parser) readInformation(packet *Packet, msg []byte) (*Packet, error) {
+	if len(msg) < 1 {
+		return nil, errors.New("information packet too short")
+	}
+
+	content := msg[1:]
+
+	switch msg[0] {
+	case infoExternalVoltage:
+		if len(content) < 2 {
+			return nil, errors.New("external voltage too short")
+		}
+
+		voltage := float64(binary.BigEndian.Uint16(content)) / 100
+		packet.ExternalVoltage = &voltage
+
+		// Keep it for the locations that follow.
+		if p.status != nil {
+			status := *p.status
+			status.ExternalVoltage = &voltage
+			p.status = &status
+		}
+	case infoICCID:
+		if len(content) < 26 {
+			return nil, errors.New("sim information too short")
+		}
+
+		packet.IMSI = strings.TrimPrefix(hex.EncodeToString(content[8:16]), "0")
+		packet.ICCID = strings.TrimRight(hex.EncodeToString(content[16:26]), "f")
+		p.imsi, p.iccid = packet.IMSI, packet.ICCID
+	}
 
 	return packet, nil
 }
@@ -207,15 +500,31 @@ func (p packetData) GetSatelites() byte {
 	return p.QCSats & 0x0f
 }
 
-func (p packetData) GetTimestamp() time.Time {
+// GetTimestamp returns the time in UTC, the device sends it in loc which is
+// UTC unless it said otherwise when it logged in.
+func (p packetData) GetTimestamp(loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+
 	return time.Date(
-		time.Now().Year()/100*100+int(p.Year),
+		2000+int(p.Year),
 		time.Month(p.Month),
 		int(p.Day),
 		int(p.Hour),
 		int(p.Minute),
 		int(p.Second),
 		0,
-		time.UTC,
-	)
+		loc,
+	).UTC()
+}
+
+// decodeUTF16 converts big endian UTF-16 to UTF-8.
+func decodeUTF16(b []byte) []byte {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+
+	return []byte(string(utf16.Decode(units)))
 }
@@ -0,0 +1,270 @@
+package gt06
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/position"
+)
+
+func TestAlarm(t *testing.T) {
+	body := []byte{
+		0x18, 0x09, 0x10, 0x02, 0x39, 0x17, // date time
+		0xc6,                   // gps info length / satellites
+		0x02, 0x6b, 0x3f, 0x3e, // latitude
+		0x0c, 0x38, 0xc6, 0x0a, // longitude
+		0x00,       // speed
+		0x14, 0x00, // course status
+		0x09,             // lbs length
+		0x01, 0xcc, 0x00, // mcc mnc
+		0x28, 0x7d, // lac
+		0x00, 0x1f, 0xb8, // cell id
+		0x04, 0x06, 0x04, // terminal information, voltage, gsm signal
+		0x01, 0x02, // alarm, language
+	}
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoAlarm, body, 1, false)))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	assert.True(t, packet.Valid())
+	assert.True(t, packet.Position)
+	assert.Equal(t, 6, packet.Satelites)
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+}
+
+func TestStatus(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(protoStatus, []byte{0x46, 0x04, 0x03, 0x00, 0x02}, 1, false))
+	stream.Write(frame(protoHeartbeat, []byte{0x46, 0x04, 0xb0, 0x04, 0x01, 0x02}, 2, false))
+
+	p := &Parser{reader: bufio.NewReader(&stream)}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.False(t, packet.Valid())
+	assert.Empty(t, packet.Alarms())
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Equal(t, position.Float(4*100/6.0), pos.Battery)
+	assert.Equal(t, position.Float(75), pos.Signal)
+	assert.Nil(t, pos.Power)
+	assert.Equal(t, position.Bool(true), pos.Ignition)
+	assert.Equal(t, position.Bool(true), pos.Charging)
+	assert.Equal(t, position.Bool(false), pos.Armed)
+	assert.Equal(t, position.Bool(true), pos.Tracking)
+	assert.Equal(t, position.Bool(false), pos.Immobilized)
+
+	// The heartbeat has external voltage instead of the voltage level.
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+
+	packet.Update(pos)
+	assert.Equal(t, position.Float(4*100/6.0), pos.Battery)
+	assert.Equal(t, position.Float(100), pos.Signal)
+	assert.Equal(t, position.Float(12), pos.Power)
+}
+
+func TestRespond(t *testing.T) {
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoLogin, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0x01, 0x23, 0x45}, 1, false)))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, []byte{0x78, 0x78, 0x05, 0x01, 0x00, 0x01, 0xd9, 0xdc, 0x0d, 0x0a}, buf.Bytes())
+
+	// Extended packets get extended responses.
+	p = &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoTimeCalibration, nil, 2, true)))}
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, []byte{0x79, 0x79, 0x00, 0x0b, protoTimeCalibration}, buf.Bytes()[:5])
+	assert.Equal(t, byte(time.Now().UTC().Year()%100), buf.Bytes()[5])
+}
+
+func TestGPSLBS(t *testing.T) {
+	body := []byte{
+		0x18, 0x09, 0x10, 0x02, 0x39, 0x17, // date time
+		0xc6,                   // gps info length / satellites
+		0x02, 0x6b, 0x3f, 0x3e, // latitude
+		0x0c, 0x38, 0xc6, 0x0a, // longitude
+		0x00,       // speed
+		0x14, 0x00, // course status
+		0x01, 0xcc, 0x00, // mcc mnc
+		0x28, 0x7d, // lac
+		0x00, 0x1f, 0xb8, // cell id
+		0x01,       // acc
+		0x00, 0x00, // upload mode, reupload
+	}
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoGPSLBS, body, 1, true)))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.True(t, packet.Valid())
+	assert.False(t, packet.WantsResponse())
+
+	pos := packet.Location()
+	assert.Equal(t, position.FixGPS, pos.Fix)
+	assert.Equal(t, position.Bool(true), pos.Ignition)
+	assert.Equal(t, []position.Cell{{MCC: 460, LAC: 0x287d, CellID: 0x1fb8}}, pos.Cells)
+}
+
+func TestWiFi(t *testing.T) {
+	body := []byte{
+		0x18, 0x09, 0x10, 0x02, 0x39, 0x17, // date time
+		0x01, 0xcc, 0x00, // mcc mnc
+		0x28, 0x7d, 0x00, 0x1f, 0xb8, 0x30, // lac, cell id, rssi
+		0x28, 0x7d, 0x00, 0x1f, 0xb9, 0x20, // neighbours
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xff,                                     // timing advance
+		0x01,                                     // access points
+		0xcc, 0x2d, 0x21, 0x4a, 0x3b, 0x10, 0x3c, // mac, strength
+	}
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoWiFi, body, 1, false)))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.False(t, packet.Valid())
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Equal(t, []position.Cell{
+		{MCC: 460, LAC: 0x287d, CellID: 0x1fb8, Signal: 0x30},
+		{MCC: 460, LAC: 0x287d, CellID: 0x1fb9, Signal: 0x20},
+	}, pos.Cells)
+	assert.Equal(t, []position.WiFi{{MAC: "cc:2d:21:4a:3b:10", Signal: -60}}, pos.WiFi)
+}
+
+func TestInformation(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(protoInformation, []byte{infoExternalVoltage, 0x04, 0xb0}, 1, true))
+	stream.Write(frame(protoInformation, []byte{
+		infoICCID,
+		0x08, 0x68, 0x12, 0x00, 0x12, 0x34, 0x56, 0x78, // imei
+		0x04, 0x60, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, // imsi
+		0x89, 0x86, 0x01, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0x34, // iccid
+	}, 2, true))
+	stream.Write(frame(protoTimeCalibration, nil, 3, false))
+
+	p := &Parser{reader: bufio.NewReader(&stream)}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.False(t, packet.WantsResponse())
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Equal(t, position.Float(12), pos.Power)
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "460011234567890", packet.IMSI)
+	assert.Equal(t, []string{"iccid_89860112345678901234"}, packet.DescribeDevice().Identifiers)
+
+	packet.Update(pos)
+	assert.Equal(t, "460011234567890", pos.IMSI)
+	assert.Equal(t, "89860112345678901234", pos.ICCID)
+
+	// The SIM is remembered for the packets that follow.
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "89860112345678901234", packet.Location().ICCID)
+}
+
+func TestCommandReply(t *testing.T) {
+	enc := newEncoder()
+
+	b, err := enc.Encode(command.Command{Command: "DYD"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x78, 0x78, 0x0e, protoCommand, 0x08, 0x00, 0x00, 0x00, 0x01, 'D', 'Y', 'D', '#', 0x00, 0x01}, b[:15])
+
+	_, err = enc.Encode(command.Command{Command: "RELAY", Args: []string{"1#"}})
+	assert.NoError(t, err)
+
+	var stream bytes.Buffer
+	stream.Write(frame(protoString, append([]byte{0x0c, 0x00, 0x00, 0x00, 0x02}, "RELAY:OK\x00\x02"...), 1, false))
+	stream.Write(frame(protoStringInfo, append([]byte{0x00, 0x00, 0x00, 0x01, encodingUTF16}, 0x00, 'O', 0x00, 'K'), 2, false))
+
+	p := &Parser{reader: bufio.NewReader(&stream), commands: enc}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.False(t, packet.WantsResponse())
+	assert.Equal(t, "RELAY", packet.Reply().Command)
+	assert.Equal(t, "RELAY:OK", packet.Reply().Response)
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "DYD", packet.Reply().Command)
+	assert.Equal(t, "OK", packet.Reply().Response)
+}
+
+func TestLoginTimezone(t *testing.T) {
+	location := []byte{
+		0x18, 0x09, 0x10, 0x02, 0x39, 0x17, // date time
+		0xc6,                   // gps info length / satellites
+		0x02, 0x6b, 0x3f, 0x3e, // latitude
+		0x0c, 0x38, 0xc6, 0x0a, // longitude
+		0x00,       // speed
+		0x14, 0x00, // course status
+	}
+
+	var stream bytes.Buffer
+	stream.Write(frame(protoLogin, []byte{
+		0x01, 0x23, 0x45, 0x67, 0x89, 0x01, 0x23, 0x45, // terminal id
+		0x36, 0x03, // type identification
+		0x3e, 0x82, // +10:00, english
+	}, 1, false))
+	stream.Write(frame(protoLocation, location, 2, false))
+
+	p := &Parser{reader: bufio.NewReader(&stream)}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "123456789012345", packet.Device())
+	assert.Equal(t, "3603", packet.TypeID)
+	assert.Equal(t, "UTC+10:00", packet.Timezone)
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 9, 15, 16, 57, 23, 0, time.UTC), packet.Timestamp)
+
+	// West of GMT.
+	p = &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoLogin, []byte{
+		0x01, 0x23, 0x45, 0x67, 0x89, 0x01, 0x23, 0x45,
+		0x36, 0x03,
+		0x14, 0xa8, // -03:30
+	}, 1, false)))}
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC-03:30", packet.Timezone)
+	assert.Equal(t, time.Date(2018, 9, 16, 6, 27, 23, 0, time.UTC), packetData{Year: 18, Month: 9, Day: 16, Hour: 2, Minute: 57, Second: 23}.GetTimestamp(p.location))
+
+	// Minutes past the hour.
+	p = &Parser{reader: bufio.NewReader(bytes.NewReader(frame(protoLogin, []byte{
+		0x01, 0x23, 0x45, 0x67, 0x89, 0x01, 0x23, 0x45,
+		0x36, 0x03,
+		0x21, 0x20, // +05:30
+	}, 1, false)))}
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC+05:30", packet.Timezone)
+	assert.Equal(t, time.Date(2018, 9, 15, 21, 27, 23, 0, time.UTC), packetData{Year: 18, Month: 9, Day: 16, Hour: 2, Minute: 57, Second: 23}.GetTimestamp(p.location))
+}
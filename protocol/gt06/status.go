@@ -0,0 +1,164 @@
+package gt06
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/position"
+)
+
+// Status is the terminal information sent with status, heartbeat and alarm
+// packets.
+type Status struct {
+	Info            terminalInfo `json:"terminal_info"`
+	VoltageLevel    *byte        `json:"voltage_level,omitempty"`
+	ExternalVoltage *float64     `json:"external_voltage,omitempty"`
+	GSMSignal       byte         `json:"gsm_signal"`
+	Alarm           byte         `json:"alarm"`
+	Language        byte         `json:"language"`
+}
+
+// terminalInfo is the terminal information content byte.
+type terminalInfo byte
+
+// Defence (armed) is activated.
+func (t terminalInfo) Defence() bool {
+	return t&0x01 == 0x01
+}
+
+// ACC (ignition) is high.
+func (t terminalInfo) ACC() bool {
+	return t&0x02 == 0x02
+}
+
+// Charging is on.
+func (t terminalInfo) Charging() bool {
+	return t&0x04 == 0x04
+}
+
+// Alarm is the alarm held in bits 3 to 5.
+func (t terminalInfo) Alarm() byte {
+	return byte(t>>3) & 0x07
+}
+
+// Tracking is true if GPS tracking is on.
+func (t terminalInfo) Tracking() bool {
+	return t&0x40 == 0x40
+}
+
+// Cut is true if oil and electricity are disconnected.
+func (t terminalInfo) Cut() bool {
+	return t&0x80 == 0x80
+}
+
+// Battery converts the voltage level, 0 (no power) to 6 (very high), to an
+// approximate percentage, nil if there is no voltage level.
+func (s *Status) Battery() *float64 {
+	if s.VoltageLevel == nil {
+		return nil
+	}
+
+	level := *s.VoltageLevel
+	if level > 6 {
+		level = 6
+	}
+
+	battery := float64(level) * 100 / 6
+
+	return &battery
+}
+
+// Signal converts the GSM signal strength, 0 (none) to 4 (strong), to a
+// percentage.
+func (s *Status) Signal() *float64 {
+	level := s.GSMSignal
+	if level > 4 {
+		level = 4
+	}
+
+	return position.Float(float64(level) * 25)
+}
+
+// apply adds what the status says to a position.
+func (s *Status) apply(pos *position.Position) {
+	pos.Battery = s.Battery()
+	pos.Signal = s.Signal()
+	pos.Power = s.ExternalVoltage
+	pos.Ignition = position.Bool(s.Info.ACC())
+	pos.Charging = position.Bool(s.Info.Charging())
+	pos.Armed = position.Bool(s.Info.Defence())
+	pos.Tracking = position.Bool(s.Info.Tracking())
+	pos.Immobilized = position.Bool(s.Info.Cut())
+}
+
+// alarms decodes the alarm held in the terminal information and the alarm
+// byte.
+func (s *Status) alarms() []event.Alarm {
+	var active []event.Alarm
+
+	if alarm, ok := infoAlarms[s.Info.Alarm()]; ok {
+		active = append(active, alarm)
+	}
+
+	if alarm, ok := alarms[s.Alarm]; ok && (len(active) == 0 || active[0] != alarm) {
+		active = append(active, alarm)
+	}
+
+	return active
+}
+
+var infoAlarms = map[byte]event.Alarm{
+	0x01: event.AlarmVibration,
+	0x02: event.AlarmPowerCut,
+	0x03: event.AlarmLowBattery,
+	0x04: event.AlarmSOS,
+}
+
+// readStatus reads the terminal information, heartbeat packets have the
+// external voltage where the voltage level usually is.
+func readStatus(reader *bytes.Reader, heartbeat bool) (*Status, error) {
+	var s Status
+
+	info, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Info = terminalInfo(info)
+
+	if heartbeat {
+		var voltage uint16
+		if err := binary.Read(reader, binary.BigEndian, &voltage); err != nil {
+			return nil, err
+		}
+
+		external := float64(voltage) / 100
+		s.ExternalVoltage = &external
+	} else {
+		level, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		s.VoltageLevel = &level
+	}
+
+	if s.GSMSignal, err = reader.ReadByte(); err != nil {
+		return nil, err
+	}
+
+	// Not every device sends the alarm and language.
+	if s.Alarm, err = reader.ReadByte(); err == io.EOF {
+		return &s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if s.Language, err = reader.ReadByte(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,29 @@
+package h02
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+type encoder struct {
+	deviceID string
+}
+
+func newEncoder(p *Packet) *encoder {
+	return &encoder{
+		deviceID: p.DeviceID,
+	}
+}
+
+// Encode frames a command as *HQ,ID,CMD,HHMMSS,args...# the time being that
+// the command was sent.
+func (e *encoder) Encode(cmd command.Command) ([]byte, error) {
+	fields := strings.Split(strings.TrimSuffix(cmd.Text(), "#"), ",")
+
+	out := append([]string{"*HQ", e.deviceID, fields[0], time.Now().In(time.UTC).Format("150405")}, fields[1:]...)
+
+	return []byte(fmt.Sprintf("%s#", strings.Join(out, ","))), nil
+}
@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/position"
 )
 
 type Packet struct {
@@ -14,9 +19,21 @@ type Packet struct {
 	Heading   float64   `json:"heading"`
 	Speed     float64   `json:"speed"`
 	Position  bool      `json:"position"`
-	Battery   float64   `json:"battery"`
+	Battery   *float64  `json:"battery,omitempty"`
+	Status    *Status   `json:"status,omitempty"`
+
+	Signal     *float64        `json:"signal,omitempty"`
+	Satellites *int            `json:"satellites,omitempty"`
+	Steps      *int            `json:"steps,omitempty"`
+	Rolling    *int            `json:"rolling,omitempty"`
+	Cells      []position.Cell `json:"cells,omitempty"`
+	IMSI       string          `json:"imsi,omitempty"`
+	ICCID      string          `json:"iccid,omitempty"`
+	Command    string          `json:"command,omitempty"`
+	Response   string          `json:"response,omitempty"`
 
 	packetType string
+	received   time.Time
 }
 
 func (p *Packet) MQTTID() string {
@@ -27,6 +44,10 @@ func (p *Packet) Device() string {
 	return p.DeviceID
 }
 
+func (p *Packet) Protocol() string {
+	return Name
+}
+
 func (p *Packet) Respond(writer io.Writer) error {
 	_, err := fmt.Fprintf(writer, `*HQ,%s,V4,V1,%s#`, p.DeviceID, time.Now().In(time.UTC).Format(`20060102150405`))
 	return err
@@ -36,6 +57,116 @@ func (p *Packet) WantsResponse() bool {
 	return p.packetType == "HQ:V1"
 }
 
+// Valid is true for the packets with a location, heartbeats and cell towers
+// update the last one.
 func (p *Packet) Valid() bool {
-	return true
+	switch p.packetType {
+	case "HQ:V1", "HQ:V19", "$":
+		return true
+	}
+
+	return false
+}
+
+// Reply returns the command a V4 acknowledges.
+func (p *Packet) Reply() *command.Result {
+	if p.packetType != "HQ:V4" {
+		return nil
+	}
+
+	return &command.Result{
+		Command:   p.Command,
+		Status:    command.StatusReply,
+		Response:  p.Response,
+		Timestamp: p.received,
+	}
+}
+
+// Alarms are those raised in the status.
+func (p *Packet) Alarms() []event.Alarm {
+	if p.Status == nil {
+		return nil
+	}
+
+	return p.Status.alarms()
+}
+
+func (p *Packet) SupportedAlarms() []event.Alarm {
+	return []event.Alarm{
+		event.AlarmSOS,
+		event.AlarmOverspeed,
+		event.AlarmPowerCut,
+		event.AlarmVibration,
+	}
+}
+
+func (p *Packet) Location() *position.Position {
+	pos := &position.Position{
+		Device:    p.Device(),
+		Protocol:  Name,
+		Timestamp: p.Timestamp,
+		Received:  p.received,
+		Fix:       position.FixFrom(p.Position),
+		Latitude:  p.Latitude,
+		Longitude: p.Longitude,
+		Speed:     position.Float(p.Speed),
+		Heading:   position.Float(p.Heading),
+		Battery:   p.Battery,
+		IMSI:      p.IMSI,
+		ICCID:     p.ICCID,
+	}
+
+	if p.Status != nil {
+		p.Status.apply(pos)
+	}
+
+	return pos
+}
+
+// Update adds what a heartbeat or cell tower report says to a position.
+func (p *Packet) Update(pos *position.Position) {
+	switch p.packetType {
+	case "HQ:LINK":
+		pos.Battery = p.Battery
+		pos.Signal = p.Signal
+		pos.Satellites = p.Satellites
+		pos.Steps = p.Steps
+		pos.Rolling = p.Rolling
+	case "HQ:NBR":
+		pos.Cells = p.Cells
+	default:
+		return
+	}
+
+	if p.Status != nil {
+		p.Status.apply(pos)
+	}
+
+	if p.ICCID != "" {
+		pos.IMSI = p.IMSI
+		pos.ICCID = p.ICCID
+	}
+
+	pos.Received = p.received
+}
+
+func (p *Packet) Sensors() []homeassistant.Sensor {
+	return []homeassistant.Sensor{
+		homeassistant.SensorBattery,
+		homeassistant.SensorSpeed,
+		homeassistant.SensorSatellites,
+		homeassistant.SensorSignal,
+		homeassistant.SensorSteps,
+		homeassistant.SensorRolling,
+	}
+}
+
+func (p *Packet) DescribeDevice() homeassistant.Device {
+	var d homeassistant.Device
+
+	if p.ICCID != "" {
+		d.Identifiers = []string{"iccid_" + p.ICCID}
+	}
+
+	return d
 }
@@ -2,6 +2,7 @@ package h02
 
 import (
 	"bufio"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -9,12 +10,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/freman/gps2mqtt/position"
 	"github.com/rs/zerolog"
 )
 
 type Parser struct {
 	reader *bufio.Reader
 	log    zerolog.Logger
+
+	// imsi and iccid are from the last V19, so every packet on the
+	// connection carries them.
+	imsi  string
+	iccid string
 }
 
 type errUnsupportedPacket struct {
@@ -48,6 +55,8 @@ func (p *Parser) ReadPacket() (packet *Packet, err error) {
 			return nil, fmt.Errorf("ascii error: %w", err)
 		}
 
+		p.sim(packet)
+
 		return packet, nil
 	case '$':
 		packet, err := p.readBinaryPacket()
@@ -55,12 +64,24 @@ func (p *Parser) ReadPacket() (packet *Packet, err error) {
 			return nil, fmt.Errorf("binary error: %w", err)
 		}
 
+		p.sim(packet)
+
 		return packet, nil
 	}
 
 	return nil, errors.New("bad packet")
 }
 
+// sim remembers the SIM card a V19 reported, or adds it to other packets.
+func (p *Parser) sim(packet *Packet) {
+	if packet.IMSI != "" || packet.ICCID != "" {
+		p.imsi, p.iccid = packet.IMSI, packet.ICCID
+		return
+	}
+
+	packet.IMSI, packet.ICCID = p.imsi, p.iccid
+}
+
 func (p *Parser) readAsciiPacket() (packet *Packet, err error) {
 	var str string
 
@@ -69,54 +90,214 @@ func (p *Parser) readAsciiPacket() (packet *Packet, err error) {
 	}
 
 	data := strings.Split(str, ",")
-	switch data[0] + ":" + data[2] {
+	if len(data) < 3 {
+		return nil, errors.New("bad packet (" + str + ")")
+	}
+
+	packet = &Packet{
+		packetType: data[0] + ":" + data[2],
+		DeviceID:   data[1],
+	}
+
+	switch packet.packetType {
 	case "HQ:V1": // Location
-		packet = &Packet{
-			packetType: "HQ:V1",
+		return p.readLocation(packet, data)
+	case "HQ:V19": // Location with sim data
+		if _, err := p.readLocation(packet, data); err != nil {
+			return nil, err
+		}
 
-			DeviceID: data[1],
-			Position: strings.EqualFold(data[4], "A"),
+		if len(data) > 14 {
+			packet.IMSI = data[13]
+			packet.ICCID = strings.TrimRight(strings.ToLower(data[14]), "f")
 		}
-		ts := data[11] + data[3]
-		if packet.Timestamp, err = time.Parse("020106150405", ts); err != nil {
-			return nil, fmt.Errorf("%w (%s != 020106150405)", err, ts)
+
+		return packet, nil
+	case "HQ:NBR": // Cell towers
+		return p.readNeighbours(packet, data)
+	case "HQ:LINK": // Heartbeat
+		return p.readLink(packet, data)
+	case "HQ:V4": // Command acknowledgement
+		if len(data) < 4 {
+			return nil, errors.New("command acknowledgement too short")
 		}
 
-		if packet.Latitude, err = strLatitude(data[5], strings.EqualFold(data[6], "S")); err != nil {
-			return nil, fmt.Errorf("failed to parse latitude (%s): %w", data[6], err)
+		packet.Command = data[3]
+		packet.Response = strings.Join(data[3:], ",")
+
+		return packet, nil
+	}
+
+	return nil, errors.New("bad packet (" + packet.packetType + ")")
+}
+
+// readLocation reads a V1 style location.
+// *HQ,ID,V1,HHMMSS,A,DDMM.MMMM,N,DDDMM.MMMM,E,speed,course,DDMMYY,status,...#
+func (p *Parser) readLocation(packet *Packet, data []string) (_ *Packet, err error) {
+	if len(data) < 12 {
+		return nil, errors.New("location too short")
+	}
+
+	packet.Position = strings.EqualFold(data[4], "A")
+
+	if packet.Timestamp, err = parseTime(data[11], data[3]); err != nil {
+		return nil, err
+	}
+
+	if packet.Latitude, err = strLatitude(data[5], strings.EqualFold(data[6], "S")); err != nil {
+		return nil, fmt.Errorf("failed to parse latitude (%s): %w", data[6], err)
+	}
+
+	if packet.Longitude, err = strLongitude(data[7], strings.EqualFold(data[8], "W")); err != nil {
+		return nil, fmt.Errorf("failed to parse longitude (%s): %w", data[8], err)
+	}
+
+	if packet.Speed, err = strconv.ParseFloat(data[9], 64); err != nil {
+		return nil, fmt.Errorf("failed to parse speed (%s): %w", data[9], err)
+	}
+
+	packet.Speed *= 1.852 // Convert from knots to km/hr
+
+	if data[10] != "" { // Null is 0 apparently
+		if packet.Heading, err = strconv.ParseFloat(data[10], 64); err != nil {
+			return nil, fmt.Errorf("failed to parse heading (%s): %w", data[10], err)
 		}
+	}
 
-		if packet.Longitude, err = strLongitude(data[7], strings.EqualFold(data[8], "W")); err != nil {
-			return nil, fmt.Errorf("failed to parse longitude (%s): %w", data[8], err)
+	if len(data) > 12 {
+		if packet.Status, err = parseStatus(data[12]); err != nil {
+			return nil, err
 		}
+	}
 
-		if packet.Speed, err = strconv.ParseFloat(data[9], 64); err != nil {
-			return nil, fmt.Errorf("failed to parse speed (%s): %w", data[9], err)
+	if packet.packetType == "HQ:V1" && len(data) > 17 && data[17] != "" {
+		tmpi, err := strconv.Atoi(data[17])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse battery (%s): %w", data[17], err)
 		}
 
-		packet.Speed *= 1.852 // Convert from knots to km/hr
+		packet.Battery = position.Float(batteryConversion(tmpi))
+	}
+
+	return packet, nil
+}
+
+// readNeighbours reads the serving and neighbouring cells.
+// *HQ,ID,NBR,HHMMSS,MCC,MNC,TA,count,LAC,CID,RXLEV,...,DDMMYY,status#
+func (p *Parser) readNeighbours(packet *Packet, data []string) (_ *Packet, err error) {
+	if len(data) < 8 {
+		return nil, errors.New("cell towers too short")
+	}
+
+	mcc, err := strconv.ParseUint(data[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mcc (%s): %w", data[4], err)
+	}
 
-		if data[10] != "" { // Null is 0 apparently
-			if packet.Heading, err = strconv.ParseFloat(data[10], 64); err != nil {
-				return nil, fmt.Errorf("failed to parse heading (%s): %w", data[10], err)
-			}
+	mnc, err := strconv.ParseUint(data[5], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mnc (%s): %w", data[5], err)
+	}
+
+	count, err := strconv.Atoi(data[7])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cell count (%s): %w", data[7], err)
+	}
+
+	if len(data) < 9+count*3 {
+		return nil, fmt.Errorf("expected %d cell towers", count)
+	}
+
+	packet.Cells = make([]position.Cell, 0, count)
+
+	for i := 0; i < count; i++ {
+		cell := data[8+i*3 : 11+i*3]
+
+		lac, err := strconv.ParseUint(cell[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse lac (%s): %w", cell[0], err)
 		}
 
-		if data[17] != "" {
-			tmpi, err := strconv.Atoi(data[17])
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse battery (%s): %w", data[17], err)
-			}
+		cid, err := strconv.ParseUint(cell[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cell id (%s): %w", cell[1], err)
+		}
 
-			packet.Battery = batteryConversion(tmpi)
+		signal, err := strconv.Atoi(cell[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signal (%s): %w", cell[2], err)
 		}
 
-		return packet, nil
-	case "HQ:V19": // Sim data
-		return nil, &errUnsupportedPacket{"HQ:V19"}
+		// Devices pad the list with empty cells.
+		if lac == 0 && cid == 0 {
+			continue
+		}
+
+		packet.Cells = append(packet.Cells, position.Cell{
+			MCC:    uint16(mcc),
+			MNC:    uint16(mnc),
+			LAC:    uint32(lac),
+			CellID: uint32(cid),
+			Signal: signal,
+		})
+	}
+
+	if packet.Timestamp, err = parseTime(data[8+count*3], data[3]); err != nil {
+		return nil, err
+	}
+
+	if len(data) > 9+count*3 {
+		if packet.Status, err = parseStatus(data[9+count*3]); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil, errors.New("bad packet (" + data[0] + ":" + data[2] + ")")
+	return packet, nil
+}
+
+// readLink reads a heartbeat.
+// *HQ,ID,LINK,HHMMSS,RSSI,satellites,battery,steps,rolling,DDMMYY,status#
+func (p *Parser) readLink(packet *Packet, data []string) (_ *Packet, err error) {
+	if len(data) < 10 {
+		return nil, errors.New("heartbeat too short")
+	}
+
+	values := make([]int, 5)
+	for i := range values {
+		if values[i], err = strconv.Atoi(data[4+i]); err != nil {
+			return nil, fmt.Errorf("failed to parse heartbeat (%s): %w", data[4+i], err)
+		}
+	}
+
+	// The signal is the CSQ, 0 to 31.
+	packet.Signal = position.Float(float64(values[0]) * 100 / 31)
+	packet.Satellites = position.Int(values[1])
+	packet.Battery = position.Float(batteryConversion(values[2]))
+	packet.Steps = position.Int(values[3])
+	packet.Rolling = position.Int(values[4])
+
+	if packet.Timestamp, err = parseTime(data[9], data[3]); err != nil {
+		return nil, err
+	}
+
+	if len(data) > 10 {
+		if packet.Status, err = parseStatus(data[10]); err != nil {
+			return nil, err
+		}
+	}
+
+	return packet, nil
+}
+
+func parseTime(date, clock string) (time.Time, error) {
+	ts := date + clock
+
+	t, err := time.Parse("020106150405", ts)
+	if err != nil {
+		return t, fmt.Errorf("%w (%s != 020106150405)", err, ts)
+	}
+
+	return t, nil
 }
 
 func (p *Parser) readBinaryPacket() (packet *Packet, err error) {
@@ -134,7 +315,7 @@ func (p *Parser) readBinaryPacket() (packet *Packet, err error) {
 	packet = &Packet{
 		packetType: "$",
 		DeviceID:   hex.EncodeToString(data[0:5]),
-		Battery:    batteryConversion(int(data[15])),
+		Battery:    position.Float(batteryConversion(int(data[15]))),
 		Position:   data[20]&2 == 2,
 	}
 
@@ -166,6 +347,8 @@ func (p *Parser) readBinaryPacket() (packet *Packet, err error) {
 		return nil, fmt.Errorf("failed to parse heading (%s): %w", hexSpeedDir[3:6], err)
 	}
 
+	packet.Status = newStatus(binary.BigEndian.Uint32(data[24:28]))
+
 	return packet, nil
 }
 
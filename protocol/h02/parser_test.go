@@ -0,0 +1,136 @@
+package h02
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/position"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, msg string) *Packet {
+	t.Helper()
+
+	p := &Parser{reader: bufio.NewReader(strings.NewReader(msg))}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	return packet
+}
+
+func TestLocation(t *testing.T) {
+	packet := parse(t, "*HQ,4106012736,V1,224434,A,1827.3855,N,06705.7577,W,000.00,000,100117,FFFFFBFF#")
+	assert.True(t, packet.Valid())
+	assert.True(t, packet.WantsResponse())
+	assert.Equal(t, time.Date(2017, 1, 10, 22, 44, 34, 0, time.UTC), packet.Timestamp)
+	assert.Nil(t, packet.Battery)
+
+	packet = parse(t, "*HQ,4209917484,V19,093043,V,5052.9749,N,00426.4322,E,000.00,000,130622,,0032475874141,8944500601200748830F#")
+	assert.True(t, packet.Valid())
+	assert.False(t, packet.WantsResponse())
+	assert.Equal(t, "0032475874141", packet.IMSI)
+	assert.Equal(t, []string{"iccid_8944500601200748830"}, packet.DescribeDevice().Identifiers)
+
+	pos := packet.Location()
+	assert.Equal(t, "0032475874141", pos.IMSI)
+	assert.Equal(t, "8944500601200748830", pos.ICCID)
+
+	// Later packets on the connection carry the SIM too.
+	p := &Parser{reader: bufio.NewReader(strings.NewReader("" +
+		"*HQ,4209917484,V19,093043,V,5052.9749,N,00426.4322,E,000.00,000,130622,,0032475874141,8944500601200748830F#" +
+		"*HQ,4209917484,V1,093043,V,5052.9749,N,00426.4322,E,000.00,000,130622,FFFFFBFF#",
+	))}
+
+	_, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "8944500601200748830", packet.Location().ICCID)
+}
+
+func TestNeighbours(t *testing.T) {
+	packet := parse(t, "*HQ,164099169,NBR,160000,262,02,255,6,802,234,10,802,233,10,802,232,10,0,0,0,0,0,0,0,0,0,061121,FFFFFBFF#")
+	assert.False(t, packet.Valid())
+	assert.Equal(t, time.Date(2021, 11, 6, 16, 0, 0, 0, time.UTC), packet.Timestamp)
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Len(t, pos.Cells, 3)
+	assert.Equal(t, position.Cell{MCC: 262, MNC: 2, LAC: 802, CellID: 234, Signal: 10}, pos.Cells[0])
+}
+
+func TestLink(t *testing.T) {
+	packet := parse(t, "*HQ,355488020533263,LINK,112137,20,8,67,1200,3,181116,FFFFFBFF#")
+	assert.False(t, packet.Valid())
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Equal(t, position.Float(67), pos.Battery)
+	assert.Equal(t, position.Int(8), pos.Satellites)
+	assert.Equal(t, position.Int(1200), pos.Steps)
+	assert.Equal(t, position.Int(3), pos.Rolling)
+	assert.InDelta(t, 64.5, *pos.Signal, 0.1)
+}
+
+func TestReply(t *testing.T) {
+	packet := parse(t, "*HQ,4106012736,V4,S20,DONE,224434,A,1827.3855,N,06705.7577,W,000.00,000,100117,FFFFFBFF#")
+	assert.False(t, packet.Valid())
+	assert.False(t, packet.WantsResponse())
+
+	res := packet.Reply()
+	assert.Equal(t, "S20", res.Command)
+	assert.True(t, strings.HasPrefix(res.Response, "S20,DONE,"))
+	assert.Nil(t, parse(t, "*HQ,4106012736,V1,224434,A,1827.3855,N,06705.7577,W,000.00,000,100117,FFFFFBFF#").Reply())
+}
+
+func TestStatus(t *testing.T) {
+	// Captured from a tracker, from traccar's H02 decoder tests. ACC is off
+	// and nothing is raised.
+	packet := parse(t, "*HQ,4210051415,V1,164549,A,0956.3869,N,08406.7068,W,000.00,000,221215,FFFFFBFF,712,01,0,0,6#")
+	assert.True(t, packet.Valid())
+	assert.Empty(t, packet.Alarms())
+	assert.Equal(t, uint32(0xfffffbff), packet.Status.Raw)
+	assert.Equal(t, position.Bool(false), packet.Location().Ignition)
+	assert.Equal(t, position.Bool(false), packet.Location().Armed)
+	assert.Equal(t, position.Bool(false), packet.Location().Door)
+
+	// The same with ACC on and SOS pressed.
+	packet = parse(t, "*HQ,4210051415,V1,164549,A,0956.3869,N,08406.7068,W,000.00,000,221215,FFFFFFFD,712,01,0,0,6#")
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+	assert.Equal(t, position.Bool(true), packet.Location().Ignition)
+
+	// Door open and fortified, with SOS raised on bit 18 instead.
+	packet = parse(t, "*HQ,4210051415,V1,164549,A,0956.3869,N,08406.7068,W,000.00,000,221215,FFFBFCFF,712,01,0,0,6#")
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+	assert.Equal(t, position.Bool(true), packet.Location().Ignition)
+	assert.Equal(t, position.Bool(true), packet.Location().Armed)
+	assert.Equal(t, position.Bool(true), packet.Location().Door)
+
+	packet = parse(t, "*HQ,355488020533263,LINK,112137,20,8,67,1200,3,181116,FFF7FBFB#")
+	assert.Equal(t, []event.Alarm{event.AlarmOverspeed, event.AlarmPowerCut}, packet.Alarms())
+
+	pos := &position.Position{}
+	packet.Update(pos)
+	assert.Equal(t, position.Bool(false), pos.Ignition)
+
+	binary := []byte{'$',
+		0x41, 0x06, 0x01, 0x27, 0x36, // id
+		0x22, 0x44, 0x34, 0x10, 0x01, 0x17, // time date
+		0x18, 0x27, 0x38, 0x55, // latitude
+		0x06,                         // battery
+		0x06, 0x70, 0x55, 0x75, 0x7c, // longitude, flags
+		0x00, 0x00, 0x00, // speed, course
+		0xff, 0xff, 0xfb, 0xfe, // status
+	}
+	binary = append(binary, make([]byte, 51-len(binary))...)
+
+	packet = parse(t, string(binary))
+	assert.True(t, packet.Valid())
+	assert.Equal(t, []event.Alarm{event.AlarmVibration}, packet.Alarms())
+	assert.False(t, packet.Status.ACC)
+}
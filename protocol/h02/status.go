@@ -0,0 +1,97 @@
+package h02
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/position"
+)
+
+// Status is the vehicle status sent with locations and heartbeats. The
+// device clears a bit to raise it, except for ACC. The alarm bits are those
+// traccar's H02 decoder uses (H02ProtocolDecoder.processStatus), door and
+// fortification are the first two bits of the third byte next to ACC, the
+// rest are left in Raw.
+type Status struct {
+	ACC       bool `json:"acc"`
+	Door      bool `json:"door"`
+	Fortified bool `json:"fortified"`
+	SOS       bool `json:"sos"`
+	Overspeed bool `json:"overspeed"`
+	PowerCut  bool `json:"power_cut"`
+	Vibration bool `json:"vibration"`
+
+	Raw uint32 `json:"raw"`
+}
+
+const (
+	statusVibration uint32 = 1 << 0
+	statusSOS       uint32 = 1 << 1
+	statusOverspeed uint32 = 1 << 2
+	statusDoor      uint32 = 1 << 8
+	statusFortified uint32 = 1 << 9
+	statusACC       uint32 = 1 << 10
+	statusSOS2      uint32 = 1 << 18
+	statusPowerCut  uint32 = 1 << 19
+)
+
+func newStatus(raw uint32) *Status {
+	cleared := func(bit uint32) bool {
+		return raw&bit == 0
+	}
+
+	return &Status{
+		ACC:       !cleared(statusACC),
+		Door:      cleared(statusDoor),
+		Fortified: cleared(statusFortified),
+		SOS:       cleared(statusSOS) || cleared(statusSOS2),
+		Overspeed: cleared(statusOverspeed),
+		PowerCut:  cleared(statusPowerCut),
+		Vibration: cleared(statusVibration),
+		Raw:       raw,
+	}
+}
+
+// parseStatus parses the hex status of the text messages, nil if the device
+// left it out.
+func parseStatus(field string) (*Status, error) {
+	if field == "" {
+		return nil, nil
+	}
+
+	raw, err := strconv.ParseUint(field, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status (%s): %w", field, err)
+	}
+
+	return newStatus(uint32(raw)), nil
+}
+
+// apply adds what the status says to a position.
+func (s *Status) apply(pos *position.Position) {
+	pos.Ignition = position.Bool(s.ACC)
+	pos.Armed = position.Bool(s.Fortified)
+	pos.Door = position.Bool(s.Door)
+}
+
+// alarms returns the alarms the status raises.
+func (s *Status) alarms() []event.Alarm {
+	var active []event.Alarm
+
+	for _, alarm := range []struct {
+		raised bool
+		alarm  event.Alarm
+	}{
+		{s.SOS, event.AlarmSOS},
+		{s.Overspeed, event.AlarmOverspeed},
+		{s.PowerCut, event.AlarmPowerCut},
+		{s.Vibration, event.AlarmVibration},
+	} {
+		if alarm.raised {
+			active = append(active, alarm.alarm)
+		}
+	}
+
+	return active
+}
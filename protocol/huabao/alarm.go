@@ -0,0 +1,130 @@
+package huabao
+
+import (
+	"fmt"
+
+	"github.com/freman/gps2mqtt/event"
+)
+
+// alarmFlag is a bit of the alarm flags in a location report. Not every
+// bit has an event, manual ones stay raised until acknowledged with 0x8203.
+type alarmFlag struct {
+	bit    uint
+	name   string
+	alarm  event.Alarm
+	manual bool
+}
+
+// alarmFlags is the JT/T 808-2013 alarm table, bits 15 to 17 are reserved.
+var alarmFlags = []alarmFlag{
+	{0, "emergency", event.AlarmSOS, true},
+	{1, "overspeed", event.AlarmOverspeed, false},
+	{2, "fatigue", event.AlarmFatigue, false},
+	{3, "danger_warning", "", true},
+	{4, "gnss_fault", event.AlarmGNSSFault, false},
+	{5, "gnss_antenna_disconnected", event.AlarmGNSSFault, false},
+	{6, "gnss_antenna_short", event.AlarmGNSSFault, false},
+	{7, "power_low", event.AlarmLowBattery, false},
+	{8, "power_cut", event.AlarmPowerCut, false},
+	{9, "display_fault", "", false},
+	{10, "tts_fault", "", false},
+	{11, "camera_fault", "", false},
+	{12, "ic_card_fault", "", false},
+	{13, "overspeed_warning", "", false},
+	{14, "fatigue_warning", "", false},
+	{18, "driving_timeout", "", false},
+	{19, "parking_timeout", "", false},
+	{20, "area", event.AlarmGeofence, true},
+	{21, "route", "", true},
+	{22, "route_time", "", true},
+	{23, "route_deviation", "", false},
+	{24, "vss_fault", "", false},
+	{25, "fuel_abnormal", "", false},
+	{26, "theft", event.AlarmTheft, false},
+	{27, "illegal_ignition", event.AlarmIgnition, true},
+	{28, "illegal_displacement", event.AlarmMovement, true},
+	{29, "collision", event.AlarmCollision, false},
+	{30, "rollover", event.AlarmRollover, false},
+	{31, "illegal_door", event.AlarmDoor, false},
+}
+
+// alarmNames returns the names of the raised alarm flags.
+func alarmNames(flags uint32) []string {
+	var names []string
+
+	for _, a := range alarmFlags {
+		if flags&(1<<a.bit) != 0 {
+			names = append(names, a.name)
+		}
+	}
+
+	return names
+}
+
+// manualAlarms returns the bits of the named manual alarms, all of them if
+// none are named.
+func manualAlarms(names []string) (uint32, error) {
+	var flags uint32
+
+	for _, a := range alarmFlags {
+		if a.manual && len(names) == 0 {
+			flags |= 1 << a.bit
+		}
+	}
+
+	for _, name := range names {
+		found := false
+
+		for _, a := range alarmFlags {
+			if a.manual && a.name == name {
+				flags |= 1 << a.bit
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("%q isn't an alarm that can be acknowledged", name)
+		}
+	}
+
+	return flags, nil
+}
+
+// Alarms are the events of the raised alarm flags, each alarm once.
+func (p *Packet) Alarms() []event.Alarm {
+	var active []event.Alarm
+
+	for _, a := range alarmFlags {
+		if p.alarm&(1<<a.bit) != 0 {
+			active = appendAlarm(active, a.alarm)
+		}
+	}
+
+	return active
+}
+
+func (p *Packet) SupportedAlarms() []event.Alarm {
+	var supported []event.Alarm
+
+	for _, a := range alarmFlags {
+		supported = appendAlarm(supported, a.alarm)
+	}
+
+	return supported
+}
+
+// appendAlarm appends alarm unless it's already there, several bits can
+// raise the same alarm and some raise none.
+func appendAlarm(alarms []event.Alarm, alarm event.Alarm) []event.Alarm {
+	if alarm == "" {
+		return alarms
+	}
+
+	for _, a := range alarms {
+		if a == alarm {
+			return alarms
+		}
+	}
+
+	return append(alarms, alarm)
+}
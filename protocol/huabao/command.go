@@ -0,0 +1,108 @@
+package huabao
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+var terminalResults = map[byte]string{
+	0: "success",
+	1: "failure",
+	2: "message error",
+	3: "not supported",
+}
+
+// terminalResponse is the body of the terminal general response (0x0001)
+// a device sends after receiving a platform message.
+type terminalResponse struct {
+	Sequence    uint16
+	MessageType uint16
+	Code        byte
+}
+
+func (t terminalResponse) Result() *command.Result {
+	res := &command.Result{
+		Command:   fmt.Sprintf("%04x", t.MessageType),
+		Status:    command.StatusReply,
+		Response:  terminalResults[t.Code],
+		Timestamp: time.Now(),
+	}
+
+	if t.Code != 0 {
+		res.Error = res.Response
+	}
+
+	return res
+}
+
+type encoder struct {
+	mu       sync.Mutex
+	terminal terminalBCD
+	sequence uint16
+}
+
+func newEncoder(p *Packet) *encoder {
+	return &encoder{
+		terminal: p.header.Terminal,
+	}
+}
+
+// Encode builds a platform message, the command is the message ID in hex
+// (eg 8201 to query the location) and the optional first argument is the
+// hex encoded message body. The arguments of 8203 are instead the names of
+// the alarms to acknowledge, all of them if there are none.
+func (e *encoder) Encode(cmd command.Command) ([]byte, error) {
+	messageType, err := strconv.ParseUint(cmd.Name(), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %q: %w", cmd.Name(), err)
+	}
+
+	var body []byte
+	if uint16(messageType) == protoAlarmAck {
+		if body, err = alarmAck(strings.Split(cmd.Text(), ",")[1:]); err != nil {
+			return nil, err
+		}
+	} else if len(cmd.Args) > 0 {
+		if body, err = hex.DecodeString(cmd.Args[0]); err != nil {
+			return nil, fmt.Errorf("invalid message body: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := (writer{&buf}).Write(frame(uint16(messageType), e.terminal, e.nextSequence(), body)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// alarmAck is the body of a manual alarm acknowledgement, sequence 0 being
+// every report that raised the alarms.
+func alarmAck(names []string) ([]byte, error) {
+	flags, err := manualAlarms(names)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 6)
+	binary.BigEndian.PutUint32(body[2:], flags)
+
+	return body, nil
+}
+
+func (e *encoder) nextSequence() uint16 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.sequence++
+
+	return e.sequence
+}
@@ -2,12 +2,14 @@ package huabao
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"net"
 	"syscall"
 	"time"
 
+	"github.com/freman/gps2mqtt/command"
 	"github.com/freman/gps2mqtt/mqtt"
 	"github.com/freman/gps2mqtt/protocol"
 	"github.com/freman/gps2mqtt/status"
@@ -25,33 +27,40 @@ type Listener struct {
 	ReadTimeout  time.Duration
 }
 
-func (l *Listener) Run(chMsg chan mqtt.Identifier) error {
+func (l *Listener) Run(ctx context.Context, chMsg chan mqtt.Identifier) error {
 	l.log.Info().Str("cfg", l.Listen).Msg("Starting listener.")
 
 	nl, err := net.Listen("tcp", l.Listen)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	for {
-		c, err := nl.Accept()
+	return protocol.Accept(ctx, nl, func(c net.Conn) {
+		l.Serve(ctx, c, chMsg)
+	})
+}
 
-		if err != nil {
-			l.log.Fatal().Err(err).Msg("Unable to start listener.")
-		}
+func (l *Listener) Address() string {
+	return l.Listen
+}
 
-		logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
-		logger.Info().Msg("Client connected.")
-		l.connections.Connected(c)
+func (l *Listener) Detect(peek []byte) bool {
+	return len(peek) > 0 && peek[0] == 0x7e
+}
 
-		go l.HandleConnection(c, chMsg, logger)
-	}
+func (l *Listener) Serve(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier) {
+	logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
+	logger.Info().Msg("Client connected.")
+	l.connections.Connected(c)
+
+	l.HandleConnection(ctx, c, chMsg, logger)
 }
 
-func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
+func (l *Listener) HandleConnection(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
 	defer func() {
 		log.Info().Msg("Client disconnected.")
 		l.connections.Disconnected(c)
+		command.Unregister(c)
 
 		if err := c.Close(); err != nil {
 			log.Error().Err(err).Msg("Error while closing client connection.")
@@ -62,15 +71,22 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 		reader: bufio.NewReader(c),
 	}
 
+	registered := false
+
 	for {
 		if err := c.SetReadDeadline(time.Now().Add(l.ReadTimeout)); err != nil {
 			log.Error().Err(err).Msg("Failed to set a read deadline.")
 			return
 		}
 
+		// Checked after setting the deadline so a drain can't be overridden.
+		if ctx.Err() != nil {
+			return
+		}
+
 		packet, err := p.ReadPacket()
 		if err != nil {
-			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) {
+			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) || ctx.Err() != nil {
 				return
 			}
 
@@ -84,6 +100,8 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
+		packet.received = time.Now()
+
 		if !l.CheckWhitelist(packet) {
 			log.Warn().Str("device", packet.Device()).Msg("Rejecting unknown device.")
 			c.Close()
@@ -91,22 +109,17 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
+		if !registered {
+			command.Register(packet, c, newEncoder(packet), l.WriteTimeout)
+			registered = true
+		}
+
 		l.connections.Packet(c, packet)
 
 		if packet.WantResponse() {
-			if err := c.SetWriteDeadline(time.Now().Add(l.WriteTimeout)); err != nil {
-				log.Error().Err(err).Msg("Failed to set a write deadline.")
-				return
-			}
-
-			if err := packet.Respond(c); err != nil {
+			if err := command.Write(c, l.WriteTimeout, packet.Respond); err != nil {
 				log.Error().Err(err).Msg("Failed to finish handshake.")
 			}
-
-			if err := c.SetWriteDeadline(time.Time{}); err != nil {
-				log.Error().Err(err).Msg("Failed to clear a write deadline.")
-				return
-			}
 		}
 
 		chMsg <- packet
@@ -9,15 +9,20 @@ import (
 	"time"
 
 	"github.com/freman/gps2mqtt/checksum"
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/position"
 )
 
 const (
+	protoTerminalResponse uint16 = 0x0001
 	protoRegister         uint16 = 0x0100
 	protoRegisterResponse uint16 = 0x8100
 	protoTerminalAuth     uint16 = 0x0102
 	protoGeneralResponse  uint16 = 0x8001
 	protoHeartbeat        uint16 = 0x0002
 	protoLocationReport   uint16 = 0x0200
+	protoAlarmAck         uint16 = 0x8203
 )
 
 type properties uint16
@@ -93,9 +98,25 @@ type Packet struct {
 	TerminalModel  string `json:"model"`
 	TerminalID     string `json:"terminal_id"`
 
-	header header
+	Status     *Status  `json:"status,omitempty"`
+	AlarmFlags []string `json:"alarm_flags,omitempty"`
+
+	header   header
+	reply    *command.Result
+	received time.Time
+	reported reported
+	alarm    uint32
 }
 
+// reported is which of the optional additional information was sent.
+type reported uint8
+
+const (
+	reportedRSSI reported = 1 << iota
+	reportedSatellites
+	reportedBattery
+)
+
 func (p *Packet) MQTTID() string {
 	return p.DeviceID
 }
@@ -104,6 +125,10 @@ func (p *Packet) Device() string {
 	return p.DeviceID
 }
 
+func (p *Packet) Protocol() string {
+	return Name
+}
+
 func (p *Packet) Respond(wr io.Writer) error {
 	switch p.header.MessageType {
 	case protoRegister:
@@ -134,27 +159,37 @@ func (p *Packet) sendGeneralResponse(wr io.Writer) error {
 }
 
 func (p *Packet) respondWith(messageType uint16, body bytes.Buffer, wr io.Writer) error {
+	_, err := writer{wr}.Write(frame(messageType, p.header.Terminal, 0, body.Bytes()))
+	return err
+}
+
+// frame wraps a message body with the header, checksum and flag bytes, the
+// result still needs escaping by writer.
+func frame(messageType uint16, terminal terminalBCD, sequence uint16, body []byte) []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(0x7e)
 
 	binary.Write(&buf, binary.BigEndian, header{
 		MessageType: messageType,
-		Properties:  properties(body.Len()),
-		Terminal:    p.header.Terminal,
-		Sequence:    0,
+		Properties:  properties(len(body)),
+		Terminal:    terminal,
+		Sequence:    sequence,
 	})
 
-	buf.Write(body.Bytes())
+	buf.Write(body)
 
 	buf.WriteByte(checksum.XOR(buf.Bytes()[1:]))
 	buf.WriteByte(0x7e)
 
-	_, err := writer{wr}.Write(buf.Bytes())
-	return err
+	return buf.Bytes()
 }
 
 func (p *Packet) WantResponse() bool {
-	return true
+	return p.header.MessageType != protoTerminalResponse
+}
+
+func (p *Packet) Reply() *command.Result {
+	return p.reply
 }
 
 func (p *Packet) Valid() bool {
@@ -183,6 +218,9 @@ func (p *Packet) importBasicInformation(rep basicLocationInformation) {
 	}
 
 	p.Position = rep.Status.Positioning()
+	p.Status = newStatus(rep.Status)
+	p.alarm = rep.AlarmFlags
+	p.AlarmFlags = alarmNames(rep.AlarmFlags)
 }
 
 type terminalBCD [6]byte
@@ -194,3 +232,55 @@ func (h *terminalBCD) String() string {
 func (h *terminalBCD) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + h.String() + `"`), nil
 }
+
+func (p *Packet) Location() *position.Position {
+	pos := &position.Position{
+		Device:    p.Device(),
+		Protocol:  Name,
+		Timestamp: p.Timestamp,
+		Received:  p.received,
+		Fix:       position.FixFrom(p.Position),
+		Latitude:  p.Latitude,
+		Longitude: p.Longitude,
+		Altitude:  position.Float(p.Altitude),
+		Speed:     position.Float(p.Speed),
+		Heading:   position.Float(p.Heading),
+	}
+
+	if p.Status != nil {
+		p.Status.apply(pos)
+	}
+
+	if p.reported&reportedSatellites != 0 {
+		pos.Satellites = position.Int(int(p.Satellites))
+	}
+
+	if p.reported&reportedBattery != 0 {
+		pos.Battery = position.Float(p.Battery)
+	}
+
+	// RSSI is the modem's CSQ, 0-31 with 99 being unknown.
+	if p.reported&reportedRSSI != 0 && p.RSSI <= 31 {
+		pos.Signal = position.Float(p.RSSI * 100 / 31)
+	}
+
+	return pos
+}
+
+func (p *Packet) Sensors() []homeassistant.Sensor {
+	return []homeassistant.Sensor{
+		homeassistant.SensorBattery,
+		homeassistant.SensorSpeed,
+		homeassistant.SensorAltitude,
+		homeassistant.SensorSatellites,
+		homeassistant.SensorSignal,
+	}
+}
+
+func (p *Packet) DescribeDevice() homeassistant.Device {
+	return homeassistant.Device{
+		Manufacturer: p.ManufacturerID,
+		Model:        p.TerminalModel,
+		SerialNumber: p.TerminalID,
+	}
+}
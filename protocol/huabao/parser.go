@@ -82,6 +82,13 @@ func (p *Parser) ReadPacket() (packet *Packet, err error) {
 	}
 
 	switch head.MessageType {
+	case protoTerminalResponse:
+		var rep terminalResponse
+		if err := binary.Read(bodyBuf, binary.BigEndian, &rep); err != nil {
+			return nil, err
+		}
+
+		packet.reply = rep.Result()
 	case protoRegister:
 		bodyBuf.Seek(4, io.SeekCurrent)
 		if err := binary.Read(bodyBuf, binary.BigEndian, &p.terminalInfo); err != nil {
@@ -123,6 +130,7 @@ func (p *Parser) parseAdditionalInformation(buf *bytes.Reader, packet *Packet) (
 			}
 
 			packet.RSSI = float64(tmp)
+			packet.reported |= reportedRSSI
 		case 0x31:
 			tmp, err := buf.ReadByte()
 			if err != nil {
@@ -130,6 +138,7 @@ func (p *Parser) parseAdditionalInformation(buf *bytes.Reader, packet *Packet) (
 			}
 
 			packet.Satellites = int64(tmp)
+			packet.reported |= reportedSatellites
 		case 0xd4: // LT-160
 			tmp, err := buf.ReadByte()
 			if err != nil {
@@ -137,6 +146,7 @@ func (p *Parser) parseAdditionalInformation(buf *bytes.Reader, packet *Packet) (
 			}
 
 			packet.Battery = float64(tmp)
+			packet.reported |= reportedBattery
 		case 0xe1: // ML100G
 			tmp, err := buf.ReadByte()
 			if err != nil {
@@ -144,6 +154,7 @@ func (p *Parser) parseAdditionalInformation(buf *bytes.Reader, packet *Packet) (
 			}
 
 			packet.Battery = float64(tmp)
+			packet.reported |= reportedBattery
 		default:
 			buf.Seek(int64(addLen), io.SeekCurrent) // skip
 		}
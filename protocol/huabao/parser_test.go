@@ -3,6 +3,7 @@ package huabao
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"os"
 	"regexp"
@@ -10,6 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/position"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -123,6 +127,51 @@ func TestLocationReport(t *testing.T) {
 	assert.Equal(t, 100.0, packet.Battery)
 }
 
+func TestLocation(t *testing.T) {
+	fromGPS, _ := hex.DecodeString("7e02000056019175690232007d010000000000000000000000000000000000000000000024060316074101040000000030011931010051020000570800000000000000009f173530352c30312c373030642c30386338353030322c3235e10164e2020000287e")
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(fromGPS))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	assert.Equal(t, &position.Position{
+		Device:      "019175690232",
+		Protocol:    Name,
+		Timestamp:   time.Date(2024, 06, 03, 16, 07, 41, 0, time.FixedZone("GMT+8", 8*60*60)),
+		Fix:         position.FixNone,
+		Altitude:    position.Float(0),
+		Speed:       position.Float(0),
+		Heading:     position.Float(0),
+		Satellites:  position.Int(0),
+		Battery:     position.Float(100),
+		Signal:      position.Float(25.0 * 100 / 31),
+		Ignition:    position.Bool(false),
+		Door:        position.Bool(false),
+		Immobilized: position.Bool(false),
+	}, packet.Location())
+
+	// Nothing optional comes with a heartbeat.
+	p = &Parser{reader: bufio.NewReader(bytes.NewReader([]byte{0x7e, 0x00, 0x02, 0x00, 0x00, 0x01, 0x91, 0x75, 0x69, 0x02, 0x32, 0x00, 0x01, 0x00, 0x7e}))}
+	packet, err = p.ReadPacket()
+	if assert.NoError(t, err) {
+		loc := packet.Location()
+		assert.Nil(t, loc.Satellites)
+		assert.Nil(t, loc.Battery)
+		assert.Nil(t, loc.Signal)
+	}
+}
+
+func TestAlarms(t *testing.T) {
+	// SOS and main power off
+	fromGPS, _ := hex.DecodeString("7e02000056019175690232007d010000010100000000000000000000000000000000000024060316074101040000000030011931010051020000570800000000000000009f173530352c30312c373030642c30386338353030322c3235e10164e2020000287e")
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(fromGPS))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []event.Alarm{event.AlarmSOS, event.AlarmPowerCut}, packet.Alarms())
+}
+
 func Test7DDecode(t *testing.T) {
 	fromGPS, _ := hex.DecodeString("7e02000056019175690232007d010000000000000000000000000000000000000000000024060316074101040000000030011931010051020000570800000000000000009f173530352c30312c373030642c30386338353030322c3235e10164e2020000287e")
 
@@ -222,3 +271,100 @@ func TestFromTraccarLog(t *testing.T) {
 		}
 	}
 }
+
+func TestTerminalResponse(t *testing.T) {
+	enc := &encoder{terminal: terminalBCD{0x01, 0x91, 0x75, 0x69, 0x02, 0x32}}
+
+	toGPS, err := enc.Encode(command.Command{Command: "8201"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x7e, 0x82, 0x01, 0x00, 0x00, 0x01, 0x91, 0x75, 0x69, 0x02, 0x32, 0x00, 0x01, 0x3e, 0x7e}, toGPS)
+
+	fromGPS := []byte{0x7e,
+		0x00, 0x01, // message id
+		0x00, 0x05, // properties
+		0x01, 0x91, 0x75, 0x69, 0x02, 0x32, // terminal
+		0x00, 0x0a, // sequence
+		0x00, 0x01, // response sequence
+		0x82, 0x01, // original message id
+		0x00, // result
+		0x30, // checksum
+		0x7e,
+	}
+
+	p := &Parser{reader: bufio.NewReader(bytes.NewReader(fromGPS))}
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	assert.False(t, packet.WantResponse())
+	assert.False(t, packet.Valid())
+
+	res := packet.Reply()
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "8201", res.Command)
+		assert.Equal(t, command.StatusReply, res.Status)
+		assert.Equal(t, "success", res.Response)
+		assert.Empty(t, res.Error)
+	}
+}
+
+func TestAlarmFlags(t *testing.T) {
+	body := make([]byte, 28)
+	// GNSS antenna disconnected and short, illegal ignition, collision
+	binary.BigEndian.PutUint32(body[0:], 1<<5|1<<6|1<<27|1<<29)
+	// ACC, positioned, full, fuel cut, driver door, GPS and BeiDou
+	binary.BigEndian.PutUint32(body[4:], 1<<0|1<<1|3<<8|1<<10|1<<16|1<<18|1<<19)
+	copy(body[22:], []byte{0x24, 0x06, 0x03, 0x16, 0x07, 0x41})
+
+	var buf bytes.Buffer
+	_, err := writer{&buf}.Write(frame(protoLocationReport, terminalBCD{0x01, 0x91, 0x75, 0x69, 0x02, 0x32}, 1, body))
+	assert.NoError(t, err)
+
+	p := &Parser{reader: bufio.NewReader(&buf)}
+	packet, err := p.ReadPacket()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"gnss_antenna_disconnected", "gnss_antenna_short", "illegal_ignition", "collision"}, packet.AlarmFlags)
+	assert.Equal(t, []event.Alarm{event.AlarmGNSSFault, event.AlarmIgnition, event.AlarmCollision}, packet.Alarms())
+
+	assert.Equal(t, &Status{
+		ACC:        true,
+		Positioned: true,
+		Load:       "full",
+		FuelCut:    true,
+		OpenDoors:  []string{"driver"},
+		GNSS:       []string{"gps", "beidou"},
+		Raw:        0x000d0703,
+	}, packet.Status)
+
+	loc := packet.Location()
+	assert.Equal(t, position.Bool(true), loc.Ignition)
+	assert.Equal(t, position.Bool(true), loc.Door)
+	assert.Equal(t, position.Bool(true), loc.Immobilized)
+}
+
+func TestAlarmAck(t *testing.T) {
+	enc := &encoder{terminal: terminalBCD{0x01, 0x91, 0x75, 0x69, 0x02, 0x32}}
+
+	toGPS, err := enc.Encode(command.Command{Command: "8203", Args: []string{"emergency", "illegal_ignition"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x7e,
+		0x82, 0x03, // message id
+		0x00, 0x06, // properties
+		0x01, 0x91, 0x75, 0x69, 0x02, 0x32, // terminal
+		0x00, 0x01, // sequence
+		0x00, 0x00, // every report
+		0x08, 0x00, 0x00, 0x01, // emergency and illegal ignition
+		0x33, // checksum
+		0x7e,
+	}, toGPS)
+
+	// Everything that can be acknowledged
+	toGPS, err = enc.Encode(command.Command{Command: "8203"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x18, 0x70, 0x00, 0x09}, toGPS[15:19])
+
+	_, err = enc.Encode(command.Command{Command: "8203", Args: []string{"collision"}})
+	assert.Error(t, err)
+}
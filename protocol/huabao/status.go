@@ -0,0 +1,85 @@
+package huabao
+
+import "github.com/freman/gps2mqtt/position"
+
+// Status is the JT/T 808-2013 status flags of a location report.
+type Status struct {
+	ACC          bool   `json:"acc"`
+	Positioned   bool   `json:"positioned"`
+	OutOfService bool   `json:"out_of_service"`
+	Encrypted    bool   `json:"encrypted"`
+	Load         string `json:"load,omitempty"`
+	FuelCut      bool   `json:"fuel_cut"`
+	CircuitCut   bool   `json:"circuit_cut"`
+	Locked       bool   `json:"locked"`
+
+	// OpenDoors and GNSS list which doors are open and which satellite
+	// systems are in use.
+	OpenDoors []string `json:"open_doors,omitempty"`
+	GNSS      []string `json:"gnss,omitempty"`
+
+	Raw uint32 `json:"raw"`
+}
+
+// loads is bits 8 and 9, 2 is reserved.
+var loads = []string{"empty", "half", "", "full"}
+
+var doors = []struct {
+	bit  uint
+	name string
+}{
+	{13, "front"},
+	{14, "middle"},
+	{15, "back"},
+	{16, "driver"},
+	{17, "other"},
+}
+
+var gnss = []struct {
+	bit  uint
+	name string
+}{
+	{18, "gps"},
+	{19, "beidou"},
+	{20, "glonass"},
+	{21, "galileo"},
+}
+
+func newStatus(s statusFlags) *Status {
+	set := func(bit uint) bool {
+		return s&(1<<bit) != 0
+	}
+
+	status := &Status{
+		ACC:          s.ACC(),
+		Positioned:   s.Positioning(),
+		OutOfService: set(4),
+		Encrypted:    set(5),
+		Load:         loads[s>>8&3],
+		FuelCut:      set(10),
+		CircuitCut:   set(11),
+		Locked:       set(12),
+		Raw:          uint32(s),
+	}
+
+	for _, d := range doors {
+		if set(d.bit) {
+			status.OpenDoors = append(status.OpenDoors, d.name)
+		}
+	}
+
+	for _, g := range gnss {
+		if set(g.bit) {
+			status.GNSS = append(status.GNSS, g.name)
+		}
+	}
+
+	return status
+}
+
+// apply adds what the status says to a position.
+func (s *Status) apply(pos *position.Position) {
+	pos.Ignition = position.Bool(s.ACC)
+	pos.Door = position.Bool(len(s.OpenDoors) > 0)
+	pos.Immobilized = position.Bool(s.FuelCut || s.CircuitCut)
+}
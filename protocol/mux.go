@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/rs/zerolog"
+)
+
+// peekLength is the number of bytes needed to tell the supported protocols apart.
+const peekLength = 2
+
+// Mux accepts connections on a single address on behalf of several protocols,
+// peeking at the first bytes of each connection to work out which protocol
+// should be handed the connection.
+type Mux struct {
+	log zerolog.Logger
+
+	names     []string
+	protocols map[string]Interface
+
+	Listen      string
+	PeekTimeout time.Duration
+}
+
+func NewMux(logger zerolog.Logger, listen string, protocols map[string]Interface) *Mux {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return &Mux{
+		log:         logger.With().Strs("protocols", names).Logger(),
+		names:       names,
+		protocols:   protocols,
+		Listen:      listen,
+		PeekTimeout: time.Minute,
+	}
+}
+
+func (m *Mux) Run(ctx context.Context, chMsg chan mqtt.Identifier) error {
+	m.log.Info().Str("cfg", m.Listen).Msg("Starting multiplexing listener.")
+
+	nl, err := net.Listen("tcp", m.Listen)
+	if err != nil {
+		return err
+	}
+
+	return Accept(ctx, nl, func(c net.Conn) {
+		m.dispatch(ctx, c, chMsg)
+	})
+}
+
+func (m *Mux) dispatch(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier) {
+	log := m.log.With().Str("remote", c.RemoteAddr().String()).Logger()
+
+	if err := c.SetReadDeadline(time.Now().Add(m.PeekTimeout)); err != nil {
+		log.Error().Err(err).Msg("Failed to set a read deadline.")
+		c.Close()
+
+		return
+	}
+
+	// Checked after setting the deadline so a drain can't be overridden.
+	if ctx.Err() != nil {
+		c.Close()
+
+		return
+	}
+
+	reader := bufio.NewReader(c)
+
+	peek, err := reader.Peek(peekLength)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to read enough to detect a protocol.")
+		c.Close()
+
+		return
+	}
+
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		log.Error().Err(err).Msg("Failed to clear a read deadline.")
+		c.Close()
+
+		return
+	}
+
+	for _, name := range m.names {
+		if p := m.protocols[name]; p.Detect(peek) {
+			log.Debug().Str("detected", name).Msg("Detected protocol.")
+			p.Serve(ctx, &peekedConn{Conn: c, reader: reader}, chMsg)
+
+			return
+		}
+	}
+
+	log.Warn().Hex("peek", peek).Msg("Unable to detect protocol, closing connection.")
+	c.Close()
+}
+
+// peekedConn replays the bytes consumed while detecting the protocol before
+// continuing to read from the underlying connection.
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
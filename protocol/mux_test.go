@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProtocol struct {
+	magic  byte
+	served chan []byte
+}
+
+func (f *fakeProtocol) Setup(config Configerer) error { return nil }
+func (f *fakeProtocol) Run(ctx context.Context, chMsg chan mqtt.Identifier) error {
+	return nil
+}
+func (f *fakeProtocol) Address() string         { return ":0" }
+func (f *fakeProtocol) Detect(peek []byte) bool { return peek[0] == f.magic }
+
+func (f *fakeProtocol) Serve(_ context.Context, c net.Conn, _ chan mqtt.Identifier) {
+	b, _ := io.ReadAll(c)
+	f.served <- b
+}
+
+func connPair(t *testing.T) (server, client net.Conn) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer nl.Close()
+
+	client, err = net.Dial("tcp", nl.Addr().String())
+	require.NoError(t, err)
+
+	server, err = nl.Accept()
+	require.NoError(t, err)
+
+	return server, client
+}
+
+func TestMuxDispatch(t *testing.T) {
+	watch := &fakeProtocol{magic: '[', served: make(chan []byte, 1)}
+	h02 := &fakeProtocol{magic: '*', served: make(chan []byte, 1)}
+
+	m := NewMux(zerolog.Nop(), ":0", map[string]Interface{
+		"watch": watch,
+		"h02":   h02,
+	})
+
+	server, client := connPair(t)
+
+	_, err := client.Write([]byte("*HQ,1234,V1#"))
+	require.NoError(t, err)
+	client.Close()
+
+	m.dispatch(context.Background(), server, nil)
+
+	assert.Equal(t, []byte("*HQ,1234,V1#"), <-h02.served)
+	assert.Empty(t, watch.served)
+}
+
+func TestMuxUnknownProtocol(t *testing.T) {
+	watch := &fakeProtocol{magic: '[', served: make(chan []byte, 1)}
+
+	m := NewMux(zerolog.Nop(), ":0", map[string]Interface{
+		"watch": watch,
+	})
+
+	server, client := connPair(t)
+	defer client.Close()
+
+	_, err := client.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+
+	m.dispatch(context.Background(), server, nil)
+
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Empty(t, watch.served)
+}
+
+func TestMuxDraining(t *testing.T) {
+	watch := &fakeProtocol{magic: '[', served: make(chan []byte, 1)}
+
+	m := NewMux(zerolog.Nop(), ":0", map[string]Interface{
+		"watch": watch,
+	})
+
+	server, client := connPair(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing has been sent, so without checking ctx this would wait for
+	// the peek timeout.
+	m.dispatch(ctx, server, nil)
+
+	_, err := client.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Empty(t, watch.served)
+}
@@ -1,6 +1,9 @@
 package protocol
 
 import (
+	"context"
+	"net"
+
 	"github.com/freman/gps2mqtt/mqtt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -13,7 +16,18 @@ type Configerer interface {
 
 type Interface interface {
 	Setup(config Configerer) error
-	Run(chan mqtt.Identifier) error
+	Run(context.Context, chan mqtt.Identifier) error
+
+	// Address returns the address the protocol has been configured to listen on.
+	Address() string
+
+	// Detect returns true if the first few bytes read from a connection look
+	// like they belong to this protocol.
+	Detect(peek []byte) bool
+
+	// Serve takes ownership of an accepted connection and handles it until it
+	// is closed or ctx is cancelled.
+	Serve(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier)
 }
 
 var interfaces = map[string]func(zerolog.Logger) Interface{}
@@ -0,0 +1,104 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+type encoder struct {
+	company  string
+	deviceID string
+	digits   int
+
+	voiceDirectory string
+}
+
+func newEncoder(p *Packet, voiceDirectory string) *encoder {
+	return &encoder{
+		company:        p.Company,
+		deviceID:       p.DeviceID,
+		digits:         digits(p.lengthDigits),
+		voiceDirectory: voiceDirectory,
+	}
+}
+
+// Encode frames a command as [CS*ID*LEN*CMD,args...]. Keywords are upper
+// cased, text messages and phonebook names are sent as UTF-16 hex.
+//
+//	UPLOAD,600         upload interval in seconds
+//	CR                 locate now
+//	FIND               make the watch ring
+//	MONITOR,number     have the watch call back silently (CALL rings)
+//	SOS1,number        set an SOS number, or SOS,number,number,number
+//	CENTER,number      set the center number
+//	PHB,number,name    phonebook, up to 5 pairs (PHB2 for the next 5)
+//	MESSAGE,text       show a message
+//	REMOVE,1           take-off alarm on (0 off)
+//	POWEROFF           turn the watch off
+//	TK,file            send a voice note from the voice directory
+func (e *encoder) Encode(cmd command.Command) ([]byte, error) {
+	name, args, _ := strings.Cut(cmd.Text(), ",")
+	name = strings.ToUpper(name)
+
+	switch name {
+	case "TK":
+		return e.encodeVoice(args)
+	case "MESSAGE":
+		args = encodeText(args)
+	case "PHB", "PHB2":
+		fields := strings.Split(args, ",")
+		for i := 1; i < len(fields); i += 2 {
+			fields[i] = encodeText(fields[i])
+		}
+
+		args = strings.Join(fields, ",")
+	}
+
+	content := name
+	if args != "" {
+		content += "," + args
+	}
+
+	if len(content) > maxLength(e.digits) {
+		return nil, fmt.Errorf("command too long (%d bytes)", len(content))
+	}
+
+	return []byte(fmt.Sprintf(`[%s*%s*%0*X*%s]`, e.company, e.deviceID, e.digits, len(content), content)), nil
+}
+
+// encodeText converts text to the hex of its big endian UTF-16.
+func encodeText(text string) string {
+	units := utf16.Encode([]rune(text))
+
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// encodeVoice frames a voice note, the length is of the audio before it's
+// escaped as the parser accepts either.
+func (e *encoder) encodeVoice(name string) ([]byte, error) {
+	audio, err := loadVoice(e.voiceDirectory, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(audio)+3 > maxLength(e.digits) {
+		return nil, fmt.Errorf("voice note too long (%d bytes)", len(audio))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `[%s*%s*%0*X*TK,`, e.company, e.deviceID, e.digits, len(audio)+3)
+	buf.Write(escapeVoice(audio))
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
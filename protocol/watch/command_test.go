@@ -0,0 +1,39 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/freman/gps2mqtt/command"
+)
+
+func TestEncode(t *testing.T) {
+	e := newEncoder(&Packet{Company: "3G", DeviceID: "1234567890"}, "")
+
+	for _, test := range []struct {
+		cmd      command.Command
+		expected string
+	}{
+		{command.Command{Command: "upload", Args: []string{"600"}}, "[3G*1234567890*000A*UPLOAD,600]"},
+		{command.Command{Command: "CR"}, "[3G*1234567890*0002*CR]"},
+		{command.Command{Command: "SOS,0400000001,0400000002,"}, "[3G*1234567890*001A*SOS,0400000001,0400000002,]"},
+		{command.Command{Command: "MESSAGE", Args: []string{"Hi, 你好"}}, "[3G*1234567890*0020*MESSAGE,00480069002C00204F60597D]"},
+		{command.Command{Command: "PHB,0400000001,Mum,0400000002,Dad"}, "[3G*1234567890*0033*PHB,0400000001,004D0075006D,0400000002,004400610064]"},
+	} {
+		b, err := e.Encode(test.cmd)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(b))
+	}
+}
+
+func TestCommandReply(t *testing.T) {
+	packet := parse(t, "[3G*1234567890*0006*UPLOAD]")
+	assert.False(t, packet.Valid())
+
+	res := packet.Reply()
+	assert.Equal(t, "UPLOAD", res.Command)
+	assert.Equal(t, command.StatusReply, res.Status)
+
+	assert.Nil(t, parse(t, "[3G*1234567890*0002*LK]").Reply())
+}
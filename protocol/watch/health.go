@@ -0,0 +1,73 @@
+package watch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/freman/gps2mqtt/health"
+)
+
+func isHealth(packetType string) bool {
+	switch strings.ToLower(packetType) {
+	case "bphrt", "heart", "btemp2", "oxygen":
+		return true
+	}
+
+	return false
+}
+
+// readHealth reads the health readings, watches differ in what they put
+// before the temperature and oxygen so the last value is used.
+//
+//	bphrt,systolic,diastolic,heart rate,...
+//	heart,heart rate
+//	btemp2,[mode,]temperature
+//	oxygen,[heart rate,]oxygen
+func readHealth(packet *Packet, fields []string) error {
+	var measurements []health.Measurement
+
+	switch strings.ToLower(packet.packetType) {
+	case "bphrt":
+		measurements = []health.Measurement{health.Systolic, health.Diastolic, health.HeartRate}
+	case "heart":
+		measurements = []health.Measurement{health.HeartRate}
+	case "btemp2":
+		fields = lastValue(fields)
+		measurements = []health.Measurement{health.Temperature}
+	case "oxygen":
+		fields = lastValue(fields)
+		measurements = []health.Measurement{health.Oxygen}
+	}
+
+	for i, m := range measurements {
+		if i >= len(fields) || fields[i] == "" {
+			break
+		}
+
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s (%s): %w", m, fields[i], err)
+		}
+
+		// Watches send 0 when they couldn't take the reading.
+		if value == 0 {
+			continue
+		}
+
+		packet.Health = append(packet.Health, health.Reading{Measurement: m, Value: value})
+	}
+
+	return nil
+}
+
+// lastValue returns the last non empty field.
+func lastValue(fields []string) []string {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i] != "" {
+			return fields[i:]
+		}
+	}
+
+	return nil
+}
@@ -2,12 +2,15 @@ package watch
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"net"
+	"os"
 	"syscall"
 	"time"
 
+	"github.com/freman/gps2mqtt/command"
 	"github.com/freman/gps2mqtt/mqtt"
 	"github.com/freman/gps2mqtt/protocol"
 	"github.com/freman/gps2mqtt/status"
@@ -23,35 +26,53 @@ type Listener struct {
 	Listen       string
 	WriteTimeout time.Duration
 	ReadTimeout  time.Duration
+
+	// VoiceDirectory is where voice notes are saved, and sent from, they
+	// are discarded if it's empty.
+	VoiceDirectory string
+	// VoiceTimeout is how long to wait for the next part of a voice note
+	// before saving it.
+	VoiceTimeout time.Duration
 }
 
-func (l *Listener) Run(chMsg chan mqtt.Identifier) error {
+func (l *Listener) Run(ctx context.Context, chMsg chan mqtt.Identifier) error {
 	l.log.Info().Str("cfg", l.Listen).Msg("Starting listener.")
 
 	nl, err := net.Listen("tcp", l.Listen)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	for {
-		c, err := nl.Accept()
+	return protocol.Accept(ctx, nl, func(c net.Conn) {
+		l.Serve(ctx, c, chMsg)
+	})
+}
 
-		if err != nil {
-			l.log.Fatal().Err(err).Msg("Unable to start listener.")
-		}
+func (l *Listener) Address() string {
+	return l.Listen
+}
 
-		logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
-		logger.Info().Msg("Client connected.")
-		l.connections.Connected(c)
+func (l *Listener) Detect(peek []byte) bool {
+	return len(peek) > 0 && peek[0] == '['
+}
 
-		go l.HandleConnection(c, chMsg, logger)
-	}
+func (l *Listener) Serve(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier) {
+	logger := l.log.With().IPAddr("remote", c.RemoteAddr().(*net.TCPAddr).IP).Logger()
+	logger.Info().Msg("Client connected.")
+	l.connections.Connected(c)
+
+	l.HandleConnection(ctx, c, chMsg, logger)
 }
 
-func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
+func (l *Listener) HandleConnection(ctx context.Context, c net.Conn, chMsg chan mqtt.Identifier, log zerolog.Logger) {
+	var recording recorder
+
 	defer func() {
+		l.saveVoice(recording.finish(), chMsg, log)
+
 		log.Info().Msg("Client disconnected.")
 		l.connections.Disconnected(c)
+		command.Unregister(c)
 
 		if err := c.Close(); err != nil {
 			log.Error().Err(err).Msg("Error while closing client connection.")
@@ -62,18 +83,42 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 		reader: bufio.NewReader(c),
 	}
 
+	registered := false
+
 	for {
-		if err := c.SetReadDeadline(time.Now().Add(l.ReadTimeout)); err != nil {
+		timeout := l.ReadTimeout
+		if recording.first != nil && l.VoiceTimeout < timeout {
+			timeout = l.VoiceTimeout
+		}
+
+		if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
 			log.Error().Err(err).Msg("Failed to set a read deadline.")
 			return
 		}
 
+		// Checked after setting the deadline so a drain can't be overridden.
+		if ctx.Err() != nil {
+			return
+		}
+
 		packet, err := p.ReadPacket()
 		if err != nil {
-			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) {
+			if err == io.EOF || errors.Is(err, syscall.ECONNRESET) || ctx.Err() != nil {
 				return
 			}
 
+			// No more parts, the note is complete.
+			if recording.first != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+				l.saveVoice(recording.finish(), chMsg, log)
+				continue
+			}
+
+			// The parser has skipped to the next packet.
+			if errors.Is(err, ErrFraming) || errors.Is(err, ErrContent) {
+				log.Warn().Err(err).Msg("Discarding bad packet.")
+				continue
+			}
+
 			log.Error().Err(err).Msg("Failed to read packet.")
 
 			return
@@ -84,6 +129,8 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
+		packet.received = time.Now()
+
 		if !l.CheckWhitelist(packet) {
 			log.Warn().Str("device", packet.Device()).Msg("Rejecting unknown device.")
 			c.Close()
@@ -91,28 +138,48 @@ func (l *Listener) HandleConnection(c net.Conn, chMsg chan mqtt.Identifier, log
 			return
 		}
 
+		if !registered {
+			command.Register(packet, c, newEncoder(packet, l.VoiceDirectory), l.WriteTimeout)
+			registered = true
+		}
+
 		l.connections.Packet(c, packet)
 
-		if packet.WantResponse() {
-			if err := c.SetWriteDeadline(time.Now().Add(l.WriteTimeout)); err != nil {
-				log.Error().Err(err).Msg("Failed to set a write deadline.")
-				return
-			}
+		if packet.voice == nil {
+			l.saveVoice(recording.finish(), chMsg, log)
+		} else if l.VoiceDirectory == "" {
+			log.Debug().Int("size", len(packet.voice)).Msg("Discarding voice note, no voice directory.")
+		} else {
+			l.saveVoice(recording.add(packet), chMsg, log)
+		}
 
-			if err := packet.Respond(c); err != nil {
+		if packet.WantResponse() {
+			if err := command.Write(c, l.WriteTimeout, packet.Respond); err != nil {
 				log.Error().Err(err).Msg("Failed to finish handshake.")
 			}
-
-			if err := c.SetWriteDeadline(time.Time{}); err != nil {
-				log.Error().Err(err).Msg("Failed to clear a write deadline.")
-				return
-			}
 		}
 
 		chMsg <- packet
 	}
 }
 
+// saveVoice writes a complete voice note to the voice directory and sends
+// it on to be announced, if there is one.
+func (l *Listener) saveVoice(p *Packet, chMsg chan mqtt.Identifier, log zerolog.Logger) {
+	if p == nil {
+		return
+	}
+
+	note, err := saveVoice(l.VoiceDirectory, p)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save voice note.")
+		return
+	}
+
+	p.note = note
+	chMsg <- p
+}
+
 func (l *Listener) CheckWhitelist(p *Packet) bool {
 	return l.whitelist(p.Device())
 }
@@ -121,6 +188,7 @@ func (l *Listener) Setup(config protocol.Configerer) error {
 	l.Listen = ":5093"
 	l.WriteTimeout = time.Second
 	l.ReadTimeout = time.Minute
+	l.VoiceTimeout = 5 * time.Second
 
 	if err := config.ProtocolConfiguration(Name, l); err != nil {
 		return err
@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/health"
+	"github.com/freman/gps2mqtt/homeassistant"
+	"github.com/freman/gps2mqtt/position"
+	"github.com/freman/gps2mqtt/voice"
 )
 
 type Packet struct {
 	Company       string `json:"company"`
 	DeviceID      string `json:"device_id"`
-	ContentLength uint16 `json:"content_length"`
+	ContentLength uint32 `json:"content_length"`
 	Content       string `json:"content,omitempty"`
 
 	Timestamp time.Time `json:"timestamp"`
@@ -20,11 +27,33 @@ type Packet struct {
 	Speed     float64   `json:"speed"`
 	Position  bool      `json:"position"`
 
-	Satellites int64   `json:"satellites"`
-	RSSI       float64 `json:"rssi"`
-	Battery    float64 `json:"battery"`
+	Satellites int64    `json:"satellites"`
+	RSSI       float64  `json:"rssi"`
+	Battery    *float64 `json:"battery,omitempty"`
+	Steps      *int     `json:"steps,omitempty"`
+	Rolling    *int     `json:"rolling,omitempty"`
+
+	Cells []position.Cell `json:"cells,omitempty"`
+	WiFi  []position.WiFi `json:"wifi,omitempty"`
+
+	ICCID  string  `json:"iccid,omitempty"`
+	Status *Status `json:"status,omitempty"`
 
+	Health []health.Reading `json:"health,omitempty"`
+
+	// packetType is the type without the network suffix 4G watches add,
+	// rawType as it was sent for the acknowledgement.
 	packetType string
+	rawType    string
+	received   time.Time
+
+	// voice is the audio of a voice note, note where it was saved.
+	voice []byte
+	note  *voice.Note
+
+	// lengthDigits is how many hex digits the watch sends the length as,
+	// it's answered in kind.
+	lengthDigits int
 }
 
 func (p *Packet) MQTTID() string {
@@ -35,15 +64,150 @@ func (p *Packet) Device() string {
 	return fmt.Sprintf("%s*%s", p.Company, p.DeviceID)
 }
 
+func (p *Packet) Protocol() string {
+	return Name
+}
+
 func (p *Packet) Respond(writer io.Writer) error {
-	_, err := fmt.Fprintf(writer, `[%s*%s*0002*%s]`, p.Company, p.DeviceID, p.packetType)
+	content := p.rawType
+	if p.voice != nil {
+		content = "TK,1"
+	}
+
+	_, err := fmt.Fprintf(writer, `[%s*%s*%0*X*%s]`, p.Company, p.DeviceID, digits(p.lengthDigits), len(content), content)
 	return err
 }
 
+// WantResponse is true for the hello, alarms, voice notes and health
+// readings, the watch keeps resending alarms until they're acknowledged.
 func (p *Packet) WantResponse() bool {
-	return p.packetType == "LK"
+	return p.packetType == "LK" || p.packetType == "AL" || p.voice != nil || isHealth(p.packetType)
 }
 
+// Valid is true for the messages that report a location, AL being UD with
+// an alarm.
 func (p *Packet) Valid() bool {
-	return p.packetType != "LK"
+	return p.packetType == "UD" || p.packetType == "UD2" || p.packetType == "AL"
+}
+
+// Alarms are only taken from AL, UD keeps reporting the alarm bits and
+// they'd be raised again.
+func (p *Packet) Alarms() []event.Alarm {
+	if p.packetType != "AL" || p.Status == nil {
+		return nil
+	}
+
+	return p.Status.alarms()
+}
+
+func (p *Packet) SupportedAlarms() []event.Alarm {
+	return []event.Alarm{
+		event.AlarmSOS,
+		event.AlarmLowBattery,
+		event.AlarmGeofence,
+		event.AlarmRemoval,
+	}
+}
+
+func containsAlarm(alarms []event.Alarm, alarm event.Alarm) bool {
+	for _, a := range alarms {
+		if a == alarm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reply treats anything the watch sends that isn't one of its own reports as
+// the echo of a command we sent it.
+func (p *Packet) Reply() *command.Result {
+	switch p.packetType {
+	case "LK", "UD", "UD2", "AL", "CCID":
+		return nil
+	}
+
+	// Voice notes from the watch, rather than the answer to one we sent.
+	if p.voice != nil || isHealth(p.packetType) {
+		return nil
+	}
+
+	return &command.Result{
+		Command:   p.packetType,
+		Status:    command.StatusReply,
+		Response:  p.Content,
+		Timestamp: time.Now(),
+	}
+}
+
+func (p *Packet) Location() *position.Position {
+	return &position.Position{
+		Device:     p.Device(),
+		Protocol:   Name,
+		Timestamp:  p.Timestamp,
+		Received:   p.received,
+		Fix:        position.FixFrom(p.Position),
+		Latitude:   p.Latitude,
+		Longitude:  p.Longitude,
+		Altitude:   position.Float(p.Altitude),
+		Speed:      position.Float(p.Speed),
+		Heading:    position.Float(p.Heading),
+		Satellites: position.Int(int(p.Satellites)),
+		Battery:    p.Battery,
+		// GSM signal strength is reported as 0-100
+		Signal:  position.Float(p.RSSI),
+		Steps:   p.Steps,
+		Rolling: p.Rolling,
+		Cells:   p.Cells,
+		WiFi:    p.WiFi,
+	}
+}
+
+// Update adds the pedometer and battery from a hello to a position.
+func (p *Packet) Update(pos *position.Position) {
+	if p.packetType != "LK" || p.Steps == nil {
+		return
+	}
+
+	pos.Steps = p.Steps
+	pos.Rolling = p.Rolling
+
+	if p.Battery != nil {
+		pos.Battery = p.Battery
+	}
+
+	pos.Received = p.received
+}
+
+func (p *Packet) Sensors() []homeassistant.Sensor {
+	return []homeassistant.Sensor{
+		homeassistant.SensorBattery,
+		homeassistant.SensorSpeed,
+		homeassistant.SensorAltitude,
+		homeassistant.SensorSatellites,
+		homeassistant.SensorSignal,
+		homeassistant.SensorSteps,
+		homeassistant.SensorRolling,
+	}
+}
+
+func (p *Packet) Readings() []health.Reading {
+	return p.Health
+}
+
+// VoiceNote returns the voice note if it was saved.
+func (p *Packet) VoiceNote() *voice.Note {
+	return p.note
+}
+
+func (p *Packet) DescribeDevice() homeassistant.Device {
+	d := homeassistant.Device{
+		Manufacturer: p.Company,
+	}
+
+	if p.ICCID != "" {
+		d.Identifiers = []string{"iccid_" + p.ICCID}
+	}
+
+	return d
 }
@@ -2,62 +2,235 @@ package watch
 
 import (
 	"bufio"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/freman/gps2mqtt/position"
+)
+
+// escape starts an escaped byte in binary content, the byte that follows
+// is the index (from 1) of the byte it stands for in escaped.
+const escape byte = 0x7d
+
+var escaped = []byte{0x7d, '[', ']', ',', '*'}
+
+// maxField is the longest vendor or device ID, and maxContent the longest
+// content, that's believed rather than treated as a broken frame.
+const (
+	maxField   = 32
+	maxContent = 1 << 20
 )
 
+// digits is how many hex digits to send a length as, at least 4.
+func digits(n int) int {
+	if n < 4 {
+		return 4
+	}
+
+	return n
+}
+
+// maxLength is the longest length that fits in n hex digits.
+func maxLength(n int) int {
+	if n >= 8 {
+		return maxContent
+	}
+
+	return 1<<(4*n) - 1
+}
+
+// ErrFraming is wrapped by errors for frames that couldn't be read, the
+// parser skips to the next [ so the connection can carry on.
+var ErrFraming = errors.New("bad frame")
+
+// ErrContent is wrapped by errors for frames that were read whole but whose
+// content couldn't be parsed, the connection can carry on with the next.
+var ErrContent = errors.New("bad content")
+
 type Parser struct {
 	reader *bufio.Reader
 }
 
-func (p *Parser) readString(delim byte) (out string, err error) {
-	out, err = p.reader.ReadString(delim)
-	return strings.TrimSuffix(out, string([]byte{delim})), err
-}
+// readField reads a header field up to the next *, a [ means the frame was
+// cut short and is left for the next packet.
+func (p *Parser) readField() (string, error) {
+	field := make([]byte, 0, 16)
 
-func (p *Parser) ReadPacket() (packet *Packet, err error) {
-	var char byte
-	if char, err = p.reader.ReadByte(); err != nil {
-		return packet, err
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch b {
+		case '*':
+			return string(field), nil
+		case '[', ']':
+			p.unreadStart(b)
+			return "", fmt.Errorf("%w: header cut short", ErrFraming)
+		}
+
+		if len(field) == maxField {
+			return "", fmt.Errorf("%w: header field longer than %d bytes", ErrFraming, maxField)
+		}
+
+		field = append(field, b)
 	}
+}
 
-	if char == '[' {
-		packet = &Packet{}
+// readContent reads length bytes of content, undoing the escaping of binary
+// content, followed by the closing bracket. The documentation doesn't say
+// whether the length counts escaped content before or after escaping so
+// either is accepted. Brackets are always escaped in content so one turning
+// up early means the frame is shorter than it said.
+func (p *Parser) readContent(length int) (string, error) {
+	content := make([]byte, 0, length)
 
-		packet.Company, err = p.readString('*')
+	for sent := 0; len(content) < length; sent++ {
+		b, err := p.reader.ReadByte()
 		if err != nil {
-			return
+			return "", err
+		}
+
+		switch b {
+		case ']':
+			if sent == length {
+				return string(content), nil
+			}
+
+			fallthrough
+		case '[':
+			p.unreadStart(b)
+			return "", fmt.Errorf("%w: content shorter than %d bytes", ErrFraming, length)
+		case escape:
+			if b, err = p.reader.ReadByte(); err != nil {
+				return "", err
+			}
+
+			if b < 1 || int(b) > len(escaped) {
+				return "", fmt.Errorf("%w: bad escape sequence 0x7d 0x%02x", ErrFraming, b)
+			}
+
+			b = escaped[b-1]
+			sent++
 		}
 
-		packet.DeviceID, err = p.readString('*')
+		content = append(content, b)
+	}
+
+	end, err := p.reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	if end != ']' {
+		p.unreadStart(end)
+		return "", fmt.Errorf("%w: content longer than %d bytes", ErrFraming, length)
+	}
+
+	return string(content), nil
+}
+
+// unreadStart puts back a [ so it starts the next packet.
+func (p *Parser) unreadStart(b byte) {
+	if b == '[' {
+		// Can't fail straight after a ReadByte.
+		_ = p.reader.UnreadByte()
+	}
+}
+
+// resync discards anything before the next [.
+func (p *Parser) resync() error {
+	skipped := 0
+
+	for {
+		b, err := p.reader.Peek(1)
 		if err != nil {
-			return
+			return err
 		}
 
-		var plen string
-		if plen, err = p.readString('*'); err != nil {
-			return
+		if b[0] == '[' {
+			break
 		}
 
-		var hlen []byte
-		if hlen, err = hex.DecodeString(plen); err != nil {
-			return
+		if _, err := p.reader.Discard(1); err != nil {
+			return err
 		}
 
-		packet.ContentLength = binary.BigEndian.Uint16(hlen)
+		skipped++
+	}
 
-		if packet.Content, err = p.readString(']'); err != nil {
-			return
-		}
+	if skipped > 0 {
+		return fmt.Errorf("%w: skipped %d bytes", ErrFraming, skipped)
+	}
+
+	return nil
+}
 
-		return p.MutatePacket(packet)
+// ReadPacket reads [Vendor*DeviceID*Length*Content], Length being 4 or more
+// hex digits. Frames that can't be read return an error wrapping ErrFraming
+// and the next call starts at the following [, content that can't be parsed
+// returns one wrapping ErrContent.
+func (p *Parser) ReadPacket() (packet *Packet, err error) {
+	if err = p.resync(); err != nil {
+		return nil, err
+	}
+
+	if _, err = p.reader.ReadByte(); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("bad packet")
+	packet = &Packet{}
+
+	if packet.Company, err = p.readField(); err != nil {
+		return nil, err
+	}
+
+	if packet.DeviceID, err = p.readField(); err != nil {
+		return nil, err
+	}
+
+	var plen string
+	if plen, err = p.readField(); err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(plen, 16, 32)
+	if err != nil || len(plen) < 4 {
+		return nil, fmt.Errorf("%w: bad length %q", ErrFraming, plen)
+	}
+
+	if length == 0 || length > maxContent {
+		return nil, fmt.Errorf("%w: bad content length %d", ErrFraming, length)
+	}
+
+	packet.ContentLength = uint32(length)
+	packet.lengthDigits = len(plen)
+
+	if packet.Content, err = p.readContent(int(packet.ContentLength)); err != nil {
+		return nil, err
+	}
+
+	if packet, err = p.MutatePacket(packet); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrContent, err)
+	}
+
+	return packet, nil
+}
+
+// packetType strips the network suffix 4G watches add to the type of their
+// locations and alarms, UD_LTE being UD.
+func packetType(raw string) string {
+	for _, suffix := range []string{"_LTE", "_WCDMA"} {
+		if t, ok := strings.CutSuffix(raw, suffix); ok {
+			return t
+		}
+	}
+
+	return raw
 }
 
 func (p Parser) MutatePacket(packet *Packet) (*Packet, error) {
@@ -67,10 +240,37 @@ func (p Parser) MutatePacket(packet *Packet) (*Packet, error) {
 		return nil, errors.New("invalid packet")
 	}
 
-	packet.packetType = packet.Content[0:2]
+	packet.rawType, _, _ = strings.Cut(packet.Content, ",")
+	packet.packetType = packetType(packet.rawType)
+
+	// TK,1 or TK,0 is the watch's answer to a voice note we sent, anything
+	// else is AMR audio.
+	if packet.packetType == "TK" {
+		_, audio, _ := strings.Cut(packet.Content, ",")
+		if audio != "0" && audio != "1" {
+			packet.voice = []byte(audio)
+			packet.Content = packet.packetType
+		}
+	}
+
+	if packet.packetType == "CCID" {
+		_, packet.ICCID, _ = strings.Cut(packet.Content, ",")
+	}
+
+	if isHealth(packet.packetType) {
+		return packet, readHealth(packet, strings.Split(packet.Content, ",")[1:])
+	}
+
+	// LK,steps,rolling,battery
+	if packet.packetType == "LK" {
+		return packet, readHello(packet, strings.Split(packet.Content, ",")[1:])
+	}
 
-	if packet.packetType == "UD" {
+	if packet.Valid() {
 		content := strings.Split(packet.Content, ",")
+		if len(content) < 14 {
+			return nil, errors.New("location data too short")
+		}
 
 		if packet.Timestamp, err = time.Parse("020106150405", content[1]+content[2]); err != nil {
 			return nil, err
@@ -116,10 +316,172 @@ func (p Parser) MutatePacket(packet *Packet) (*Packet, error) {
 			return nil, err
 		}
 
-		if packet.Battery, err = strconv.ParseFloat(content[13], 64); err != nil {
+		battery, err := strconv.ParseFloat(content[13], 64)
+		if err != nil {
 			return nil, err
 		}
+
+		packet.Battery = &battery
+
+		if len(content) > 15 {
+			if packet.Steps, err = parseCount(content[14]); err != nil {
+				return nil, err
+			}
+
+			if packet.Rolling, err = parseCount(content[15]); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(content) > 16 && content[16] != "" {
+			status, err := strconv.ParseUint(content[16], 16, 32)
+			if err != nil {
+				return nil, err
+			}
+
+			packet.Status = newStatus(uint32(status))
+		}
+
+		if len(content) > 17 {
+			if err := readNetworks(packet, content[17:]); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return packet, nil
 }
+
+// readHello reads the pedometer, rolling count and battery some watches add
+// to their hello.
+func readHello(packet *Packet, fields []string) (err error) {
+	if len(fields) < 2 {
+		return nil
+	}
+
+	if packet.Steps, err = parseCount(fields[0]); err != nil {
+		return err
+	}
+
+	if packet.Rolling, err = parseCount(fields[1]); err != nil {
+		return err
+	}
+
+	if len(fields) > 2 && fields[2] != "" {
+		battery, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return err
+		}
+
+		packet.Battery = &battery
+	}
+
+	return nil
+}
+
+// readNetworks reads the base stations and WiFi hotspots that follow the
+// terminal statement. The timing advance, country and network codes are only
+// read when there are base stations, as traccar's WatchProtocolDecoder does,
+// lists that don't fit are ignored.
+// count[,ta,mcc,mnc,lac,cell id,signal...][,count,name,mac,signal...]
+func readNetworks(packet *Packet, fields []string) error {
+	next := func() string {
+		if len(fields) == 0 {
+			return ""
+		}
+
+		field := fields[0]
+		fields = fields[1:]
+
+		return field
+	}
+
+	count, err := strconv.Atoi(next())
+	if err != nil {
+		return fmt.Errorf("failed to parse base station count: %w", err)
+	}
+
+	if count > 0 {
+		if len(fields) < 3+count*3 {
+			return nil
+		}
+
+		next() // Timing advance
+
+		mcc, err := strconv.ParseUint(next(), 10, 16)
+		if err != nil {
+			return fmt.Errorf("failed to parse mcc: %w", err)
+		}
+
+		mnc, err := strconv.ParseUint(next(), 10, 16)
+		if err != nil {
+			return fmt.Errorf("failed to parse mnc: %w", err)
+		}
+
+		for i := 0; i < count; i++ {
+			lac, err := strconv.ParseUint(next(), 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse lac: %w", err)
+			}
+
+			cid, err := strconv.ParseUint(next(), 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse cell id: %w", err)
+			}
+
+			signal, err := strconv.Atoi(next())
+			if err != nil {
+				return fmt.Errorf("failed to parse signal: %w", err)
+			}
+
+			packet.Cells = append(packet.Cells, position.Cell{
+				MCC:    uint16(mcc),
+				MNC:    uint16(mnc),
+				LAC:    uint32(lac),
+				CellID: uint32(cid),
+				Signal: signal,
+			})
+		}
+	}
+
+	if len(fields) == 0 || fields[0] == "" {
+		return nil
+	}
+
+	if count, err = strconv.Atoi(next()); err != nil {
+		return fmt.Errorf("failed to parse hotspot count: %w", err)
+	}
+
+	if len(fields) < count*3 {
+		return nil
+	}
+
+	for i := 0; i < count; i++ {
+		next() // Name
+
+		mac := strings.ToLower(next())
+
+		signal, err := strconv.Atoi(next())
+		if err != nil {
+			return fmt.Errorf("failed to parse hotspot signal: %w", err)
+		}
+
+		packet.WiFi = append(packet.WiFi, position.WiFi{MAC: mac, Signal: signal})
+	}
+
+	return nil
+}
+
+// parseCount parses a counter, nil if the watch left it empty.
+func parseCount(field string) (*int, error) {
+	if field == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(field)
+	if err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
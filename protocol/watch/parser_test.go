@@ -0,0 +1,181 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/event"
+	"github.com/freman/gps2mqtt/health"
+	"github.com/freman/gps2mqtt/position"
+)
+
+func parse(t *testing.T, msg string) *Packet {
+	t.Helper()
+
+	p := &Parser{reader: bufio.NewReader(strings.NewReader(msg))}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+
+	return packet
+}
+
+func TestAlarm(t *testing.T) {
+	packet := parse(t, "[3G*1234567890*0053*AL,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]")
+	assert.True(t, packet.Valid())
+	assert.True(t, packet.WantResponse())
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+	assert.True(t, packet.Status.LowBattery)
+	assert.True(t, packet.Status.Bracelet)
+	assert.False(t, packet.Status.OutOfFence)
+
+	var buf bytes.Buffer
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, "[3G*1234567890*0002*AL]", buf.String())
+
+	// The alarm bits aren't raised again by locations.
+	packet = parse(t, "[3G*1234567890*0053*UD,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]")
+	assert.False(t, packet.WantResponse())
+	assert.Empty(t, packet.Alarms())
+}
+
+func TestNetworkSuffix(t *testing.T) {
+	packet := parse(t, "[3G*1234567890*0057*UD_LTE,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]")
+	assert.True(t, packet.Valid())
+	assert.False(t, packet.WantResponse())
+	assert.Nil(t, packet.Reply())
+	assert.Equal(t, 22.570733, packet.Location().Latitude)
+
+	packet = parse(t, "[3G*1234567890*0059*UD_WCDMA,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]")
+	assert.True(t, packet.Valid())
+	assert.Nil(t, packet.Reply())
+
+	// Acknowledged with the type as it was sent.
+	packet = parse(t, "[3G*1234567890*0057*AL_LTE,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]")
+	assert.True(t, packet.Valid())
+	assert.True(t, packet.WantResponse())
+	assert.Equal(t, []event.Alarm{event.AlarmSOS}, packet.Alarms())
+
+	var buf bytes.Buffer
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, "[3G*1234567890*0006*AL_LTE]", buf.String())
+}
+
+func TestShortLocation(t *testing.T) {
+	p := &Parser{reader: bufio.NewReader(strings.NewReader("" +
+		"[3G*1234567890*0010*UD,180916,025723]" +
+		"[3G*1234567890*0053*UD,180916,025723,A,22.570733,N,113.8626083,E,0.00,249.5,0.0,6,100,60,0,0,00010009,0]",
+	))}
+
+	_, err := p.ReadPacket()
+	assert.ErrorIs(t, err, ErrContent)
+	assert.NotErrorIs(t, err, ErrFraming)
+
+	// The next frame is still read.
+	packet, err := p.ReadPacket()
+	if assert.NoError(t, err) {
+		assert.True(t, packet.Valid())
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	packet := parse(t, "[3G*8800000015*00A7*UD,220414,134652,V,22.571707,N,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,0000,2,1,460,0,9360,4082,131,9360,4092,148,2,home,1c:fa:68:13:a5:b4,-61,,E0:C6:3C:1D:8F:2A,-75]")
+
+	pos := packet.Location()
+	assert.Equal(t, position.FixNone, pos.Fix)
+	assert.Equal(t, position.Int(1000), pos.Steps)
+	assert.Equal(t, position.Int(50), pos.Rolling)
+	assert.Equal(t, []position.Cell{
+		{MCC: 460, LAC: 9360, CellID: 4082, Signal: 131},
+		{MCC: 460, LAC: 9360, CellID: 4092, Signal: 148},
+	}, pos.Cells)
+	assert.Equal(t, []position.WiFi{
+		{MAC: "1c:fa:68:13:a5:b4", Signal: -61},
+		{MAC: "e0:c6:3c:1d:8f:2a", Signal: -75},
+	}, pos.WiFi)
+
+	// Without base stations the WiFi count follows straight on.
+	packet = parse(t, "[3G*8800000015*0083*UD,220414,134652,V,22.571707,N,113.8613968,E,0.1,0.0,100,7,60,90,1000,50,0000,0,2,home,1c:fa:68:13:a5:b4,-61,,E0:C6:3C:1D:8F:2A,-75]")
+
+	pos = packet.Location()
+	assert.Empty(t, pos.Cells)
+	assert.Equal(t, []position.WiFi{
+		{MAC: "1c:fa:68:13:a5:b4", Signal: -61},
+		{MAC: "e0:c6:3c:1d:8f:2a", Signal: -75},
+	}, pos.WiFi)
+
+	// Hellos update the pedometer.
+	packet = parse(t, "[3G*8800000015*000D*LK,1200,60,85]")
+	packet.Update(pos)
+	assert.Equal(t, position.Int(1200), pos.Steps)
+	assert.Equal(t, position.Int(60), pos.Rolling)
+	assert.Equal(t, position.Float(85), pos.Battery)
+}
+
+func TestHealth(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		expected []health.Reading
+	}{
+		{"bphrt,120,79,73,,,,", []health.Reading{
+			{Measurement: health.Systolic, Value: 120},
+			{Measurement: health.Diastolic, Value: 79},
+			{Measurement: health.HeartRate, Value: 73},
+		}},
+		{"heart,68", []health.Reading{{Measurement: health.HeartRate, Value: 68}}},
+		{"btemp2,1,36.55", []health.Reading{{Measurement: health.Temperature, Value: 36.55}}},
+		{"oxygen,98", []health.Reading{{Measurement: health.Oxygen, Value: 98}}},
+		{"heart,0", nil},
+	} {
+		packet := parse(t, fmt.Sprintf("[3G*1234567890*%04X*%s]", len(test.content), test.content))
+		assert.Equal(t, test.expected, packet.Readings(), test.content)
+		assert.True(t, packet.WantResponse())
+		assert.Nil(t, packet.Reply())
+	}
+}
+
+func TestFraming(t *testing.T) {
+	p := &Parser{reader: bufio.NewReader(strings.NewReader("" +
+		"garbage[3G*1234567890*0002*LK]" + // resynced
+		"[3G*1234567890*0010*LK][3G*1234567890*0002*LK]" + // cut short
+		"[3G*1234567890*0001*LK]junk" + // longer than it said
+		"[3G*1234567890*0000*]" + // empty
+		"[3G*1234567890*XYZ*LK]" + // bad length
+		"[3G*1234567890*00000002*LK]", // long length
+	))}
+
+	// Each bad frame is an error, as is the garbage skipped after it.
+	for _, expected := range []string{"", "LK", "", "LK", "", "", "", "", "", "", "LK"} {
+		packet, err := p.ReadPacket()
+		if expected == "" {
+			assert.ErrorIs(t, err, ErrFraming)
+			continue
+		}
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, packet.Content)
+		}
+	}
+
+	_, err := p.ReadPacket()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestLongLength(t *testing.T) {
+	packet := parse(t, "[3G*1234567890*00000002*LK]")
+
+	var buf bytes.Buffer
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, "[3G*1234567890*00000002*LK]", buf.String())
+
+	b, err := newEncoder(packet, "").Encode(command.Command{Command: "CR"})
+	assert.NoError(t, err)
+	assert.Equal(t, "[3G*1234567890*00000002*CR]", string(b))
+}
@@ -0,0 +1,56 @@
+package watch
+
+import "github.com/freman/gps2mqtt/event"
+
+// Status is the terminal statement sent with locations, the low 16 bits are
+// the watch's state and the high 16 bits its alarms.
+type Status struct {
+	LowBattery bool `json:"low_battery"`
+	OutOfFence bool `json:"out_of_fence"`
+	InFence    bool `json:"in_fence"`
+	Bracelet   bool `json:"bracelet"`
+
+	Raw uint32 `json:"raw"`
+}
+
+const (
+	statusLowBattery uint32 = 1 << 0
+	statusOutOfFence uint32 = 1 << 1
+	statusInFence    uint32 = 1 << 2
+	statusBracelet   uint32 = 1 << 3
+)
+
+// alarms are the high 16 bits of the terminal statement.
+var alarms = []struct {
+	bit   uint32
+	alarm event.Alarm
+}{
+	{1 << 16, event.AlarmSOS},
+	{1 << 17, event.AlarmLowBattery},
+	{1 << 18, event.AlarmGeofence}, // Out of fence
+	{1 << 19, event.AlarmGeofence}, // In fence
+	{1 << 20, event.AlarmRemoval},  // Watch taken off
+}
+
+func newStatus(raw uint32) *Status {
+	return &Status{
+		LowBattery: raw&statusLowBattery != 0,
+		OutOfFence: raw&statusOutOfFence != 0,
+		InFence:    raw&statusInFence != 0,
+		Bracelet:   raw&statusBracelet != 0,
+		Raw:        raw,
+	}
+}
+
+// alarms returns the alarms raised in the statement.
+func (s *Status) alarms() []event.Alarm {
+	var active []event.Alarm
+
+	for _, a := range alarms {
+		if s.Raw&a.bit != 0 && !containsAlarm(active, a.alarm) {
+			active = append(active, a.alarm)
+		}
+	}
+
+	return active
+}
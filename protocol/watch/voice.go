@@ -0,0 +1,99 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/freman/gps2mqtt/voice"
+)
+
+// amrHeader starts an AMR file, watches leave it off later parts of a note.
+var amrHeader = []byte("#!AMR\n")
+
+// recorder puts voice notes back together, watches send a long note as
+// consecutive TK packets and only the first starts with the AMR header.
+type recorder struct {
+	first *Packet
+	audio []byte
+}
+
+// add records the audio in p, returning the note before it if p starts a
+// new one.
+func (r *recorder) add(p *Packet) *Packet {
+	var done *Packet
+	if bytes.HasPrefix(p.voice, amrHeader) {
+		done = r.finish()
+	}
+
+	if r.first == nil {
+		r.first = p
+	}
+
+	r.audio = append(r.audio, p.voice...)
+
+	return done
+}
+
+// finish returns the note recorded so far, as a copy of its first packet
+// with all of the audio, nil if there isn't one.
+func (r *recorder) finish() *Packet {
+	if r.first == nil {
+		return nil
+	}
+
+	p := *r.first
+	p.voice = r.audio
+
+	r.first, r.audio = nil, nil
+
+	return &p
+}
+
+// saveVoice writes the voice note in p to dir, named for the watch and when
+// it was received.
+func saveVoice(dir string, p *Packet) (*voice.Note, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	audio := p.voice
+	if !bytes.HasPrefix(audio, amrHeader) {
+		audio = append(append([]byte{}, amrHeader...), audio...)
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("%s_%s.amr", p.MQTTID(), p.received.UTC().Format("20060102T150405.000")))
+	if err := os.WriteFile(file, audio, 0o644); err != nil {
+		return nil, err
+	}
+
+	return voice.New(p, file, "amr", len(audio), p.received), nil
+}
+
+// loadVoice reads a voice note to send from dir, only the name of the file
+// is used so notes can't be read from anywhere else.
+func loadVoice(dir, name string) ([]byte, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("voice notes are disabled, no voice directory")
+	}
+
+	return os.ReadFile(filepath.Join(dir, filepath.Base(name)))
+}
+
+// escapeVoice escapes the bytes in audio that would otherwise be read as
+// part of the framing.
+func escapeVoice(audio []byte) []byte {
+	out := make([]byte, 0, len(audio))
+
+	for _, b := range audio {
+		if i := bytes.IndexByte(escaped, b); i >= 0 {
+			out = append(out, escape, byte(i+1))
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
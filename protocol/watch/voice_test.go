@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freman/gps2mqtt/command"
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/freman/gps2mqtt/status"
+	"github.com/freman/gps2mqtt/voice"
+)
+
+func TestVoice(t *testing.T) {
+	audio := []byte("#!AMR\n\x3c]*[,\x7d\x00")
+
+	var stream bytes.Buffer
+	stream.WriteString("[3G*1234567890*0010*TK,")
+	stream.Write(escapeVoice(audio))
+	stream.WriteString("][3G*1234567890*0002*LK]")
+
+	p := &Parser{reader: bufio.NewReader(&stream)}
+
+	packet, err := p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, audio, packet.voice)
+	assert.True(t, packet.WantResponse())
+	assert.Nil(t, packet.Reply())
+
+	var buf bytes.Buffer
+	assert.NoError(t, packet.Respond(&buf))
+	assert.Equal(t, "[3G*1234567890*0004*TK,1]", buf.String())
+
+	dir := t.TempDir()
+	packet.received = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	note, err := saveVoice(dir, packet)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "3G_1234567890_20240102T030405.000.amr"), note.File)
+
+	saved, err := os.ReadFile(note.File)
+	assert.NoError(t, err)
+	assert.Equal(t, audio, saved)
+
+	// The frame after the voice note is still found.
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "LK", packet.packetType)
+
+	// And the note can be sent back.
+	b, err := newEncoder(packet, dir).Encode(command.Command{Command: "TK", Args: []string{"../" + filepath.Base(note.File)}})
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte("[3G*1234567890*0010*TK,"), escapeVoice(audio)...), ']'), b)
+
+	packet, err = (&Parser{reader: bufio.NewReader(bytes.NewReader(b))}).ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, audio, packet.voice)
+
+	// The length may count the audio after it was escaped instead.
+	escapedAudio := escapeVoice(audio)
+	stream.Reset()
+	fmt.Fprintf(&stream, "[3G*1234567890*%04X*TK,", len(escapedAudio)+3)
+	stream.Write(escapedAudio)
+	stream.WriteString("][3G*1234567890*0002*LK]")
+
+	p = &Parser{reader: bufio.NewReader(&stream)}
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, audio, packet.voice)
+
+	packet, err = p.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "LK", packet.packetType)
+
+	// The watch's answer is a reply.
+	packet, err = (&Parser{reader: bufio.NewReader(bytes.NewReader([]byte("[3G*1234567890*0004*TK,1]")))}).ReadPacket()
+	assert.NoError(t, err)
+	assert.Nil(t, packet.voice)
+	assert.Equal(t, "TK", packet.Reply().Command)
+}
+
+func TestVoiceParts(t *testing.T) {
+	dir := t.TempDir()
+
+	l := &Listener{
+		whitelist:      func(string) bool { return true },
+		connections:    status.NewConnections("voice-parts"),
+		WriteTimeout:   time.Second,
+		ReadTimeout:    time.Minute,
+		VoiceDirectory: dir,
+		VoiceTimeout:   50 * time.Millisecond,
+	}
+
+	server, client := net.Pipe()
+	l.connections.Connected(server)
+	chMsg := make(chan mqtt.Identifier, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.HandleConnection(context.Background(), server, chMsg, zerolog.Nop())
+	}()
+
+	acks := bufio.NewReader(client)
+	send := func(content []byte) {
+		_, err := fmt.Fprintf(client, "[3G*1234567890*%04X*", len(content))
+		require.NoError(t, err)
+		_, err = client.Write(append(escapeVoice(content), ']'))
+		require.NoError(t, err)
+	}
+	tk := func(audio string) {
+		send([]byte("TK," + audio))
+		_, err := acks.ReadString(']')
+		require.NoError(t, err)
+	}
+
+	// received skips the packets that aren't notes.
+	received := func() *voice.Note {
+		for msg := range chMsg {
+			if note := msg.(*Packet).VoiceNote(); note != nil {
+				return note
+			}
+		}
+
+		return nil
+	}
+
+	// The note is saved once no more parts arrive.
+	tk("#!AMR\nfirst")
+	tk("second")
+
+	note := received()
+	saved, err := os.ReadFile(note.File)
+	assert.NoError(t, err)
+	assert.Equal(t, "#!AMR\nfirstsecond", string(saved))
+
+	// Or when the watch sends something else.
+	tk("#!AMR\nthird")
+	send([]byte("LK"))
+	_, err = acks.ReadString(']')
+	require.NoError(t, err)
+
+	note = received()
+	saved, err = os.ReadFile(note.File)
+	assert.NoError(t, err)
+	assert.Equal(t, "#!AMR\nthird", string(saved))
+
+	client.Close()
+	<-done
+	close(chMsg)
+
+	assert.Nil(t, received())
+}
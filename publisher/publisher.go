@@ -0,0 +1,191 @@
+package publisher
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+)
+
+var errNotConnected = errors.New("not connected to broker")
+
+// Client is the part of an MQTT client the publisher needs.
+type Client interface {
+	IsConnectionOpen() bool
+	Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token
+}
+
+// Message is a publish waiting to be sent.
+type Message struct {
+	Topic    string `json:"topic"`
+	QoS      byte   `json:"qos"`
+	Retained bool   `json:"retained"`
+	Payload  []byte `json:"payload"`
+}
+
+type Config struct {
+	// Directory to spool unsent messages to, if empty they are only kept in memory.
+	Directory string
+	// MaxMessages is the most messages kept before the oldest are dropped.
+	MaxMessages int
+	// Timeout is how long to wait for the broker to acknowledge a publish.
+	Timeout time.Duration
+	// Retries is how many more times to try a publish before queueing it.
+	Retries int
+}
+
+// Publisher publishes messages, queueing any that can't be delivered and
+// replaying them in order once the broker is reachable again.
+type Publisher struct {
+	log    zerolog.Logger
+	client Client
+	cfg    Config
+
+	mu    sync.Mutex
+	queue *queue
+
+	// replays wakes the goroutine that sends the queue.
+	replays chan struct{}
+}
+
+func New(logger zerolog.Logger, client Client, cfg Config) (*Publisher, error) {
+	q, err := openQueue(cfg.Directory, cfg.MaxMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Len() > 0 {
+		logger.Info().Int("depth", q.Len()).Msg("Loaded queued messages from disk.")
+	}
+
+	p := &Publisher{
+		log:     logger,
+		client:  client,
+		cfg:     cfg,
+		queue:   q,
+		replays: make(chan struct{}, 1),
+	}
+
+	go func() {
+		for range p.replays {
+			p.replay()
+		}
+	}()
+
+	return p, nil
+}
+
+// Publish sends a message, queueing it if the broker can't be reached or
+// older messages are still waiting to be sent. Queued messages are sent in
+// the background, while connected that starts straight away so a publish
+// that timed out doesn't hold up the rest until the next reconnect.
+func (p *Publisher) Publish(topic string, qos byte, retained bool, payload []byte) {
+	msg := Message{
+		Topic:    topic,
+		QoS:      qos,
+		Retained: retained,
+		Payload:  payload,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.queue.Len() == 0 {
+		err := p.send(msg)
+		if err == nil {
+			return
+		}
+
+		p.log.Warn().Err(err).Str("topic", topic).Msg("Failed to publish, queueing message.")
+	}
+
+	dropped, err := p.queue.Push(msg)
+	if err != nil {
+		p.log.Error().Err(err).Str("topic", topic).Msg("Failed to queue message.")
+	}
+
+	if dropped > 0 {
+		p.log.Warn().Int("dropped", dropped).Msg("Publish queue full, dropped oldest messages.")
+	}
+
+	if p.client.IsConnectionOpen() {
+		p.Replay()
+	}
+}
+
+// Replay starts sending queued messages in order in the background, stopping
+// at the first failure.
+func (p *Publisher) Replay() {
+	select {
+	case p.replays <- struct{}{}:
+	default:
+	}
+}
+
+// replay sends the queue without holding the lock while sending, so
+// messages published in the mean time are queued behind it.
+func (p *Publisher) replay() {
+	p.mu.Lock()
+	depth := p.queue.Len()
+	p.mu.Unlock()
+
+	if depth == 0 {
+		return
+	}
+
+	p.log.Info().Int("depth", depth).Msg("Replaying queued messages.")
+
+	for {
+		p.mu.Lock()
+		e, ok := p.queue.oldest()
+		p.mu.Unlock()
+
+		if !ok {
+			return
+		}
+
+		if err := p.send(e.msg); err != nil {
+			p.log.Warn().Err(err).Int("depth", p.Depth()).Msg("Failed to replay queued messages.")
+			return
+		}
+
+		p.mu.Lock()
+		err := p.queue.Remove(e.seq)
+		p.mu.Unlock()
+
+		if err != nil {
+			p.log.Error().Err(err).Msg("Failed to remove message from queue.")
+			return
+		}
+	}
+}
+
+// Depth returns the number of messages waiting to be sent.
+func (p *Publisher) Depth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.queue.Len()
+}
+
+func (p *Publisher) send(msg Message) (err error) {
+	for attempt := 0; attempt <= p.cfg.Retries; attempt++ {
+		if !p.client.IsConnectionOpen() {
+			return errNotConnected
+		}
+
+		token := p.client.Publish(msg.Topic, msg.QoS, msg.Retained, msg.Payload)
+		if !token.WaitTimeout(p.cfg.Timeout) {
+			err = errors.New("timed out waiting for broker")
+			continue
+		}
+
+		if err = token.Error(); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
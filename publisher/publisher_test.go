@@ -0,0 +1,107 @@
+package publisher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// token completes straight away unless it's one that times out.
+type token struct {
+	timeout bool
+}
+
+func (t token) Wait() bool                       { return !t.timeout }
+func (t token) WaitTimeout(_ time.Duration) bool { return !t.timeout }
+func (t token) Done() <-chan struct{}            { return nil }
+func (t token) Error() error                     { return nil }
+
+// client times out the first timeouts publishes.
+type client struct {
+	mu       sync.Mutex
+	timeouts int
+	tried    []string
+	sent     []string
+}
+
+func (c *client) IsConnectionOpen() bool {
+	return true
+}
+
+func (c *client) Publish(topic string, _ byte, _ bool, _ interface{}) paho.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tried = append(c.tried, topic)
+
+	if c.timeouts > 0 {
+		c.timeouts--
+		return token{timeout: true}
+	}
+
+	c.sent = append(c.sent, topic)
+
+	return token{}
+}
+
+func (c *client) setTimeouts(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timeouts = n
+}
+
+func (c *client) published() (tried, sent []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.tried...), append([]string(nil), c.sent...)
+}
+
+func TestPublishAfterTimeout(t *testing.T) {
+	c := &client{timeouts: 1}
+
+	p, err := New(zerolog.Nop(), c, Config{MaxMessages: 10, Timeout: time.Millisecond})
+	require.NoError(t, err)
+
+	p.Publish("a", 1, false, []byte("a"))
+	p.Publish("b", 1, false, []byte("b"))
+
+	// Still connected, so the queued message goes first without waiting for
+	// a reconnect.
+	assert.Eventually(t, func() bool { return p.Depth() == 0 }, time.Second, time.Millisecond)
+
+	_, sent := c.published()
+	assert.Equal(t, []string{"a", "b"}, sent)
+}
+
+func TestPublishBehindQueue(t *testing.T) {
+	c := &client{timeouts: 1 << 30}
+
+	p, err := New(zerolog.Nop(), c, Config{MaxMessages: 10, Timeout: time.Millisecond})
+	require.NoError(t, err)
+
+	p.Publish("a", 1, false, []byte("a"))
+	p.Publish("b", 1, false, []byte("b"))
+	p.Publish("c", 1, false, []byte("c"))
+	assert.Equal(t, 3, p.Depth())
+
+	// Only the head of the queue is tried while it's failing.
+	tried, _ := c.published()
+	for _, topic := range tried {
+		assert.Equal(t, "a", topic)
+	}
+
+	c.setTimeouts(0)
+	p.Replay()
+
+	assert.Eventually(t, func() bool { return p.Depth() == 0 }, time.Second, time.Millisecond)
+
+	_, sent := c.published()
+	assert.Equal(t, []string{"a", "b", "c"}, sent)
+}
@@ -0,0 +1,161 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const queueExtension = ".msg"
+
+type entry struct {
+	seq uint64
+	msg Message
+}
+
+// queue is a bounded FIFO of messages waiting to be published, if a directory
+// is given each message is also written to disk so it survives a restart.
+type queue struct {
+	dir     string
+	max     int
+	seq     uint64
+	entries []entry
+}
+
+func openQueue(dir string, max int) (*queue, error) {
+	q := &queue{
+		dir: dir,
+		max: max,
+	}
+
+	if dir == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, queueExtension) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var msg Message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return nil, fmt.Errorf("corrupt queue entry %s: %w", name, err)
+		}
+
+		q.entries = append(q.entries, entry{seq: seq, msg: msg})
+	}
+
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].seq < q.entries[j].seq
+	})
+
+	if l := len(q.entries); l > 0 {
+		q.seq = q.entries[l-1].seq
+	}
+
+	return q, nil
+}
+
+func (q *queue) Len() int {
+	return len(q.entries)
+}
+
+// Push adds a message to the end of the queue, returning the number of old
+// messages dropped to make room for it.
+func (q *queue) Push(msg Message) (dropped int, err error) {
+	q.seq++
+	e := entry{seq: q.seq, msg: msg}
+
+	if q.dir != "" {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := os.WriteFile(q.path(e.seq), b, 0o644); err != nil {
+			return 0, err
+		}
+	}
+
+	q.entries = append(q.entries, e)
+
+	for q.max > 0 && len(q.entries) > q.max {
+		if err := q.Pop(); err != nil {
+			return dropped, err
+		}
+
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// Peek returns the oldest message without removing it.
+func (q *queue) Peek() (Message, bool) {
+	e, ok := q.oldest()
+	return e.msg, ok
+}
+
+func (q *queue) oldest() (entry, bool) {
+	if len(q.entries) == 0 {
+		return entry{}, false
+	}
+
+	return q.entries[0], true
+}
+
+// Remove removes the message numbered seq if it's still the oldest, it may
+// have been dropped to make room while it was being sent.
+func (q *queue) Remove(seq uint64) error {
+	if e, ok := q.oldest(); !ok || e.seq != seq {
+		return nil
+	}
+
+	return q.Pop()
+}
+
+// Pop removes the oldest message.
+func (q *queue) Pop() error {
+	if len(q.entries) == 0 {
+		return nil
+	}
+
+	e := q.entries[0]
+	q.entries = q.entries[1:]
+
+	if q.dir != "" {
+		if err := os.Remove(q.path(e.seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueExtension))
+}
@@ -0,0 +1,53 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuePersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := openQueue(dir, 2)
+	require.NoError(t, err)
+
+	for _, topic := range []string{"a", "b", "c"} {
+		_, err := q.Push(Message{Topic: topic, Payload: []byte(topic)})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, q.Len())
+
+	// Reopening should find the two newest messages, in order.
+	q, err = openQueue(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.Len())
+
+	msg, ok := q.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, Message{Topic: "b", Payload: []byte("b")}, msg)
+
+	require.NoError(t, q.Pop())
+
+	dropped, err := q.Push(Message{Topic: "d"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, dropped)
+
+	q, err = openQueue(dir, 2)
+	require.NoError(t, err)
+
+	var topics []string
+	for {
+		msg, ok := q.Peek()
+		if !ok {
+			break
+		}
+
+		topics = append(topics, msg.Topic)
+		require.NoError(t, q.Pop())
+	}
+
+	assert.Equal(t, []string{"c", "d"}, topics)
+}
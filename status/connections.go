@@ -34,11 +34,29 @@ func (c *Connections) Packet(conn net.Conn, packet mqtt.Identifier) {
 	c.connections[conn].LastTimestamp = time.Now()
 }
 
+// Disconnected forgets a connection, if it was the last one the device
+// using it had the device is reported as gone.
 func (c *Connections) Disconnected(conn net.Conn) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
+	last := c.connections[conn]
 	delete(c.connections, conn)
+
+	gone := last != nil && last.LastPacket != nil && !c.connected(last.LastPacket.Device())
+	c.mu.Unlock()
+
+	if gone {
+		s.disconnected(last.LastPacket)
+	}
+}
+
+func (c *Connections) connected(device string) bool {
+	for _, p := range c.connections {
+		if p.LastPacket != nil && p.LastPacket.Device() == device {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (c *Connections) MarshalJSON() ([]byte, error) {
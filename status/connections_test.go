@@ -0,0 +1,51 @@
+package status
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/freman/gps2mqtt/mqtt"
+	"github.com/freman/gps2mqtt/position"
+)
+
+type identifier string
+
+func (i identifier) MQTTID() string   { return string(i) }
+func (i identifier) Device() string   { return string(i) }
+func (i identifier) Protocol() string { return "test" }
+func (i identifier) Valid() bool      { return true }
+
+func (i identifier) Location() *position.Position { return nil }
+
+func TestDisconnectedLastConnection(t *testing.T) {
+	var gone []string
+	SetDisconnectHandler(func(last mqtt.Identifier) {
+		gone = append(gone, last.Device())
+	})
+	defer SetDisconnectHandler(nil)
+
+	c := NewConnections("test")
+
+	old, _ := net.Pipe()
+	current, _ := net.Pipe()
+	rejected, _ := net.Pipe()
+
+	c.Connected(old)
+	c.Packet(old, identifier("a"))
+	c.Connected(current)
+	c.Packet(current, identifier("a"))
+	c.Connected(rejected)
+
+	// The device reconnected before the old connection timed out.
+	c.Disconnected(old)
+	assert.Empty(t, gone)
+
+	// Nothing was ever received so there's no device to report.
+	c.Disconnected(rejected)
+	assert.Empty(t, gone)
+
+	c.Disconnected(current)
+	assert.Equal(t, []string{"a"}, gone)
+}
@@ -5,12 +5,16 @@ import (
 	"net"
 	"net/http"
 	"sync"
+
+	"github.com/freman/gps2mqtt/mqtt"
 )
 
 type status struct {
 	mu sync.RWMutex
 
-	connections map[string]*Connections
+	connections  map[string]*Connections
+	queueDepth   func() int
+	onDisconnect func(last mqtt.Identifier)
 }
 
 var s = status{
@@ -30,6 +34,34 @@ func NewConnections(proto string) *Connections {
 	return c
 }
 
+// SetQueueDepth registers a function reporting how many MQTT messages are
+// waiting to be published.
+func SetQueueDepth(f func() int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queueDepth = f
+}
+
+// SetDisconnectHandler registers a function called with the last packet
+// from a device once it has no connections left.
+func SetDisconnectHandler(f func(last mqtt.Identifier)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDisconnect = f
+}
+
+func (s *status) disconnected(last mqtt.Identifier) {
+	s.mu.RLock()
+	f := s.onDisconnect
+	s.mu.RUnlock()
+
+	if f != nil {
+		f(last)
+	}
+}
+
 func (s *status) MarshalJSON() ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -40,5 +72,25 @@ func (s *status) MarshalJSON() ([]byte, error) {
 func HandleRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(s.connections)
+	json.NewEncoder(w).Encode(&s)
+}
+
+// HandleQueueRequest reports how many MQTT messages are waiting to be
+// published.
+func HandleQueueRequest(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	f := s.queueDepth
+	s.mu.RUnlock()
+
+	blob := struct {
+		Depth int `json:"depth"`
+	}{}
+
+	if f != nil {
+		blob.Depth = f()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(blob)
 }
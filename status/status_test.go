@@ -0,0 +1,29 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleRequest(t *testing.T) {
+	NewConnections("shape")
+
+	SetQueueDepth(func() int { return 3 })
+	defer SetQueueDepth(nil)
+
+	// Protocols are at the top level, as they always have been.
+	w := httptest.NewRecorder()
+	HandleRequest(w, httptest.NewRequest("GET", "/", nil))
+
+	var connections map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &connections))
+	assert.Contains(t, connections, "shape")
+	assert.NotContains(t, connections, "queue_depth")
+
+	w = httptest.NewRecorder()
+	HandleQueueRequest(w, httptest.NewRequest("GET", "/queue", nil))
+	assert.JSONEq(t, `{"depth": 3}`, w.Body.String())
+}
@@ -0,0 +1,40 @@
+package voice
+
+import (
+	"time"
+
+	"github.com/freman/gps2mqtt/mqtt"
+)
+
+// Noter is implemented by packets that can carry a voice note.
+type Noter interface {
+	// VoiceNote returns the note saved from this packet, nil if there
+	// isn't one.
+	VoiceNote() *Note
+}
+
+// Note is a voice message sent by a tracker, saved to disk.
+type Note struct {
+	Device   string `json:"device"`
+	Protocol string `json:"protocol"`
+
+	// File is where the note was saved and Format its audio format (eg amr).
+	File   string `json:"file"`
+	Format string `json:"format"`
+	Size   int    `json:"size"`
+
+	// Received is when gps2mqtt received the note.
+	Received time.Time `json:"received"`
+}
+
+// New describes a note from msg saved as file.
+func New(msg mqtt.Identifier, file, format string, size int, received time.Time) *Note {
+	return &Note{
+		Device:   msg.Device(),
+		Protocol: msg.Protocol(),
+		File:     file,
+		Format:   format,
+		Size:     size,
+		Received: received,
+	}
+}